@@ -0,0 +1,97 @@
+package librato
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/henrikhodne/go-librato/librato"
+)
+
+// libratoChangeAnnotations configures the annotations posted for every change
+// applied to alerts, metrics and space charts, so that changes can be matched
+// up with graphs later on.
+type libratoChangeAnnotations struct {
+	Stream string
+
+	// LinkEnv names the environment variable holding the URL of the commit or
+	// run that applied the change.
+	LinkEnv string
+}
+
+func libratoChangeAnnotationsExpand(d *schema.ResourceData) *libratoChangeAnnotations {
+	for _, v := range d.Get("change_annotations").([]interface{}) {
+		if v == nil {
+			continue
+		}
+		annotationsData := v.(map[string]interface{})
+		return &libratoChangeAnnotations{
+			Stream:  annotationsData["stream"].(string),
+			LinkEnv: annotationsData["link_env"].(string),
+		}
+	}
+	return nil
+}
+
+// Returns the sorted attributes of the resource changed by the applied diff.
+func libratoChangedAttributes(d *schema.ResourceData, attributes map[string]*schema.Schema) []string {
+	var changed []string
+	for k := range attributes {
+		if d.HasChange(k) {
+			changed = append(changed, k)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+func libratoChangeAnnotation(stream, resourceType, action, name string, changed []string, link string) *librato.Annotation {
+	annotation := &librato.Annotation{
+		Name:      librato.String(stream),
+		Title:     librato.String(strings.TrimSpace(fmt.Sprintf("Terraform %s %s %s", action, resourceType, name))),
+		Source:    librato.String("terraform"),
+		StartTime: librato.Uint(uint(time.Now().Unix())),
+	}
+	if len(changed) > 0 {
+		annotation.Description = librato.String(fmt.Sprintf("Changed attributes: %s", strings.Join(changed, ", ")))
+	}
+	if link != "" {
+		annotation.Links = []librato.AnnotationLink{
+			{
+				Label: librato.String("Terraform run"),
+				Rel:   librato.String("terraform"),
+				Href:  librato.String(link),
+			},
+		}
+	}
+	return annotation
+}
+
+// Posts an annotation for a change when change_annotations are enabled. A
+// failure only logs a warning, since the change itself was applied. The
+// changed attributes are listed for updates only, attributes is the schema of
+// the resource.
+func (c *Config) annotateChange(d *schema.ResourceData, resourceType, action, name string, attributes map[string]*schema.Schema) {
+	if c.ChangeAnnotations == nil {
+		return
+	}
+
+	var changed []string
+	if action == "updated" {
+		changed = libratoChangedAttributes(d, attributes)
+	}
+	var link string
+	if c.ChangeAnnotations.LinkEnv != "" {
+		link = os.Getenv(c.ChangeAnnotations.LinkEnv)
+	}
+
+	annotation := libratoChangeAnnotation(c.ChangeAnnotations.Stream, resourceType, action, name, changed, link)
+	log.Printf("[INFO] Posting Librato annotation to %s: %s", c.ChangeAnnotations.Stream, *annotation.Title)
+	if _, _, err := c.Client.Annotations.Create(annotation); err != nil {
+		log.Printf("[WARN] Error posting Librato annotation for %s %s: %s", resourceType, name, err)
+	}
+}
@@ -0,0 +1,61 @@
+package librato
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/henrikhodne/go-librato/librato"
+)
+
+func TestConfigAnnotateChange(t *testing.T) {
+	var posted librato.Annotation
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		json.NewDecoder(r.Body).Decode(&posted)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	baseURL, _ := url.Parse(server.URL + "/")
+	config := &Config{
+		Client: librato.NewClientWithBaseURL(baseURL, "user", "token"),
+		ChangeAnnotations: &libratoChangeAnnotations{
+			Stream:  "terraform",
+			LinkEnv: "TF_LIBRATO_TEST_CHANGE_URL",
+		},
+	}
+	os.Setenv("TF_LIBRATO_TEST_CHANGE_URL", "https://ci.example.com/runs/42")
+	defer os.Unsetenv("TF_LIBRATO_TEST_CHANGE_URL")
+
+	attributes := resourceLibratoAlert().Schema
+	d := schema.TestResourceDataRaw(t, attributes, map[string]interface{}{
+		"name":          "api-latency",
+		"rearm_seconds": 600,
+	})
+	config.annotateChange(d, "librato_alert", "updated", "api-latency", attributes)
+
+	if path != "/annotations/terraform" {
+		t.Fatalf("Annotation posted to %s", path)
+	}
+	if title := stringValue(posted.Title); title != "Terraform updated librato_alert api-latency" {
+		t.Fatalf("Bad title: %q", title)
+	}
+	if description := stringValue(posted.Description); description != "Changed attributes: active, name, rearm_seconds" {
+		t.Fatalf("Bad description: %q", description)
+	}
+	if len(posted.Links) != 1 || stringValue(posted.Links[0].Href) != "https://ci.example.com/runs/42" {
+		t.Fatalf("Bad links: %#v", posted.Links)
+	}
+
+	// Failing to post must not panic or fail the change
+	server.Close()
+	config.Client.MaxRetries = 0
+	config.annotateChange(d, "librato_alert", "deleted", "api-latency", nil)
+}
@@ -0,0 +1,169 @@
+package librato
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/henrikhodne/go-librato/librato"
+)
+
+// Matches the keys of values that are redacted from the audit log wherever
+// they appear. Values within service settings are redacted regardless.
+var libratoAuditSecretKeyRegexp = regexp.MustCompile(`(?i)(token|secret|password|passwd|api_?key|auth|credential|private)`)
+
+const libratoAuditRedacted = "<redacted>"
+
+// libratoAuditLog appends a JSON line to a file for every mutating request.
+// Parallel resource operations share it, so writes are serialized.
+type libratoAuditLog struct {
+	mu        sync.Mutex
+	file      *os.File
+	workspace string
+}
+
+type libratoAuditRecord struct {
+	Timestamp  string      `json:"timestamp"`
+	Workspace  string      `json:"workspace"`
+	Operation  string      `json:"operation"`
+	Method     string      `json:"method"`
+	Path       string      `json:"path"`
+	ObjectType string      `json:"object_type"`
+	ObjectID   string      `json:"object_id,omitempty"`
+	Before     interface{} `json:"before"`
+	After      interface{} `json:"after"`
+	Status     int         `json:"status"`
+	Error      string      `json:"error,omitempty"`
+}
+
+func newLibratoAuditLog(path string) (*libratoAuditLog, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("Error opening audit log: %s", err)
+	}
+
+	return &libratoAuditLog{
+		file:      file,
+		workspace: libratoWorkspace(),
+	}, nil
+}
+
+// Returns the selected Terraform workspace. Providers aren't told about it,
+// so it is read like Terraform does: from TF_WORKSPACE, or from the file
+// terraform workspace select writes to the working directory.
+func libratoWorkspace() string {
+	if v := os.Getenv("TF_WORKSPACE"); v != "" {
+		return v
+	}
+	if contents, err := ioutil.ReadFile(".terraform/environment"); err == nil {
+		if v := strings.TrimSpace(string(contents)); v != "" {
+			return v
+		}
+	}
+	return "default"
+}
+
+func (l *libratoAuditLog) record(entry *librato.AuditEntry) {
+	objectType, objectID := libratoAuditObject(entry.Path)
+	record := &libratoAuditRecord{
+		Timestamp:  entry.Time.UTC().Format(time.RFC3339Nano),
+		Workspace:  l.workspace,
+		Operation:  libratoAuditOperation(entry.Method),
+		Method:     entry.Method,
+		Path:       entry.Path,
+		ObjectType: objectType,
+		ObjectID:   objectID,
+		Before:     libratoAuditRedact(objectType, entry.Before),
+		Status:     entry.StatusCode,
+		Error:      entry.Error,
+	}
+	if entry.Method != "DELETE" {
+		record.After = libratoAuditRedact(objectType, entry.Body)
+	}
+	// Created objects are only identified by the response
+	if record.ObjectID == "" && entry.Response != nil {
+		var created struct {
+			ID interface{} `json:"id"`
+		}
+		if json.Unmarshal(entry.Response, &created) == nil && created.ID != nil {
+			record.ObjectID = fmt.Sprintf("%v", created.ID)
+		}
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		log.Printf("[WARN] Error encoding audit log record: %s", err)
+		return
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.file.Write(line); err != nil {
+		log.Printf("[WARN] Error writing audit log: %s", err)
+	}
+}
+
+func libratoAuditOperation(method string) string {
+	switch method {
+	case "POST":
+		return "create"
+	case "PUT":
+		return "update"
+	case "DELETE":
+		return "delete"
+	}
+	return strings.ToLower(method)
+}
+
+// Splits a request path into the object type and ID, e.g. "spaces/1/charts/2"
+// into "spaces/charts" and "1/2".
+func libratoAuditObject(path string) (string, string) {
+	var types, ids []string
+	for i, segment := range strings.Split(strings.Trim(path, "/"), "/") {
+		if i%2 == 0 {
+			types = append(types, segment)
+		} else {
+			ids = append(ids, segment)
+		}
+	}
+	return strings.Join(types, "/"), strings.Join(ids, "/")
+}
+
+// Decodes a request or response body with the secrets in it redacted.
+func libratoAuditRedact(objectType string, data json.RawMessage) interface{} {
+	if data == nil {
+		return nil
+	}
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil
+	}
+	return libratoAuditRedactValue(v, strings.HasPrefix(objectType, "services"), false)
+}
+
+func libratoAuditRedactValue(v interface{}, isService, redact bool) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			redactElem := redact || libratoAuditSecretKeyRegexp.MatchString(k) || (isService && k == "settings")
+			v[k] = libratoAuditRedactValue(e, isService, redactElem)
+		}
+		return v
+	case []interface{}:
+		for i, e := range v {
+			v[i] = libratoAuditRedactValue(e, isService, redact)
+		}
+		return v
+	}
+	if redact && v != nil {
+		return libratoAuditRedacted
+	}
+	return v
+}
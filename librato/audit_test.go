@@ -0,0 +1,97 @@
+package librato
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/henrikhodne/go-librato/librato"
+)
+
+func TestLibratoAuditLog(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			w.Write([]byte(`{"id": 7, "title": "Ops", "type": "slack", "settings": {"url": "https://hooks.slack.com/T0/B0/XYZ"}}`))
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "librato-audit")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	os.Setenv("TF_WORKSPACE", "production")
+	defer os.Unsetenv("TF_WORKSPACE")
+
+	auditLog, err := newLibratoAuditLog(filepath.Join(dir, "audit.log"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	baseURL, _ := url.Parse(server.URL + "/v1/")
+	client := librato.NewClientWithBaseURL(baseURL, "user", "token")
+	client.Audit = auditLog.record
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client.Services.Update(7, &librato.Service{
+				Title:    librato.String("Ops"),
+				Settings: map[string]interface{}{"url": "https://hooks.slack.com/T0/B0/NEW"},
+			})
+		}()
+	}
+	wg.Wait()
+	client.Services.Get(7)
+
+	contents, err := ioutil.ReadFile(filepath.Join(dir, "audit.log"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(contents)), "\n")
+	if len(lines) != 10 {
+		t.Fatalf("Expected 10 audit records, got %d", len(lines))
+	}
+	if strings.Contains(string(contents), "hooks.slack.com") {
+		t.Fatalf("Service settings weren't redacted:\n%s", contents)
+	}
+
+	var record libratoAuditRecord
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatalf("Bad audit record %s: %s", lines[0], err)
+	}
+	if record.Operation != "update" || record.ObjectType != "services" || record.ObjectID != "7" ||
+		record.Status != http.StatusNoContent || record.Workspace != "production" {
+		t.Fatalf("Bad audit record: %s", lines[0])
+	}
+	if record.Before == nil || record.After == nil {
+		t.Fatalf("Expected before and after bodies: %s", lines[0])
+	}
+}
+
+func TestLibratoAuditObject(t *testing.T) {
+	cases := map[string][2]string{
+		"alerts/12":         {"alerts", "12"},
+		"alerts/12/clear":   {"alerts/clear", "12"},
+		"spaces/1/charts/2": {"spaces/charts", "1/2"},
+		"spaces":            {"spaces", ""},
+	}
+	for path, expected := range cases {
+		objectType, objectID := libratoAuditObject(path)
+		if objectType != expected[0] || objectID != expected[1] {
+			t.Fatalf("%s: expected %v, got %s and %s", path, expected, objectType, objectID)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package librato
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/henrikhodne/go-librato/librato"
+)
+
+const (
+	libratoBackendLibrato   = "librato"
+	libratoBackendAppOptics = "appoptics"
+)
+
+// The attributes holding sources, by resource type. AppOptics doesn't know
+// sources, series are filtered by tags instead.
+var libratoSourceAttributes = map[string]string{
+	"librato_alert":       "condition.source",
+	"librato_alert_set":   "condition.source",
+	"librato_space_chart": "stream.source",
+	"librato_slo":         "source",
+}
+
+func libratoNewClient(backend, email, token string) (*librato.Client, error) {
+	switch backend {
+	case libratoBackendLibrato:
+		if email == "" {
+			return nil, fmt.Errorf("email must be set for the librato backend")
+		}
+		return librato.NewClient(email, token), nil
+	case libratoBackendAppOptics:
+		return librato.NewAppOpticsClient(token), nil
+	}
+	return nil, fmt.Errorf("Invalid backend %q, must be %s or %s", backend, libratoBackendLibrato, libratoBackendAppOptics)
+}
+
+// Rejects the source attributes of a resource on the AppOptics backend.
+func (c *Config) checkBackend(resourceType string, d *schema.ResourceData) error {
+	if c.Backend != libratoBackendAppOptics {
+		return nil
+	}
+	attribute, ok := libratoSourceAttributes[resourceType]
+	if !ok {
+		return nil
+	}
+
+	path := strings.Split(attribute, ".")
+	for _, v := range libratoPolicyValues(d.Get(path[0]), path[1:]) {
+		// The default source of SLOs selects every series, like no filter
+		if resourceType == "librato_slo" && v == "*" {
+			continue
+		}
+		if s, ok := v.(string); ok && s != "" {
+			return fmt.Errorf("%s %q: %s isn't supported by the appoptics backend, filter with tag blocks instead",
+				resourceType, d.Get("name").(string), attribute)
+		}
+	}
+	return nil
+}
+
+// Schema of the tag blocks filtering the series of alert conditions and chart
+// streams.
+func libratoTagSchema(dynamic bool) *schema.Schema {
+	tagSchema := map[string]*schema.Schema{
+		"name": {
+			Type:     schema.TypeString,
+			Required: true,
+		},
+		"grouped": {
+			Type:     schema.TypeBool,
+			Optional: true,
+		},
+		"values": {
+			Type:     schema.TypeList,
+			Required: !dynamic,
+			Optional: dynamic,
+			Elem:     &schema.Schema{Type: schema.TypeString},
+		},
+	}
+	// Dynamic tags of chart streams take their values from the space
+	if dynamic {
+		tagSchema["dynamic"] = &schema.Schema{
+			Type:     schema.TypeBool,
+			Optional: true,
+		}
+	}
+
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Optional: true,
+		Elem:     &schema.Resource{Schema: tagSchema},
+	}
+}
+
+// Writes the tag blocks of a condition or stream to a set hash buffer.
+func libratoTagsHash(buf *bytes.Buffer, m map[string]interface{}) {
+	tags, ok := m["tag"].([]interface{})
+	if !ok {
+		return
+	}
+	for _, t := range tags {
+		tag := t.(map[string]interface{})
+		buf.WriteString(fmt.Sprintf("%s-", tag["name"].(string)))
+		if grouped, ok := tag["grouped"].(bool); ok {
+			buf.WriteString(fmt.Sprintf("%t-", grouped))
+		}
+		if dynamic, ok := tag["dynamic"].(bool); ok && dynamic {
+			buf.WriteString("dynamic-")
+		}
+		for _, value := range tag["values"].([]interface{}) {
+			buf.WriteString(fmt.Sprintf("%s-", value.(string)))
+		}
+	}
+}
+
+func libratoStringsFlatten(values []*string) []interface{} {
+	result := make([]interface{}, 0, len(values))
+	for _, v := range values {
+		result = append(result, stringValue(v))
+	}
+	return result
+}
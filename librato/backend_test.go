@@ -0,0 +1,105 @@
+package librato
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/henrikhodne/go-librato/librato"
+)
+
+func TestLibratoNewClient(t *testing.T) {
+	if _, err := libratoNewClient(libratoBackendLibrato, "", "token"); err == nil {
+		t.Fatalf("Expected the librato backend to require an email")
+	}
+	if _, err := libratoNewClient("graphite", "ops@example.com", "token"); err == nil {
+		t.Fatalf("Expected an unknown backend to be invalid")
+	}
+
+	client, err := libratoNewClient(libratoBackendAppOptics, "", "token")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if client.BaseURL.Host != "api.appoptics.com" {
+		t.Fatalf("Bad AppOptics base URL: %s", client.BaseURL)
+	}
+
+	var username, password string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, _ = r.BasicAuth()
+		w.Write([]byte(`{"id": 1}`))
+	}))
+	defer server.Close()
+
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	client.Spaces.Get(1)
+	if username != "token" || password != "" {
+		t.Fatalf("Expected AppOptics requests to authenticate with the token only, got %q and %q", username, password)
+	}
+}
+
+func TestConfigCheckBackend(t *testing.T) {
+	alert := resourceLibratoAlert().Schema
+	withSource := schema.TestResourceDataRaw(t, alert, map[string]interface{}{
+		"name": "api-latency",
+		"condition": []interface{}{
+			map[string]interface{}{
+				"type":        "above",
+				"metric_name": "api.latency",
+				"source":      "web-*",
+			},
+		},
+	})
+	withTags := schema.TestResourceDataRaw(t, alert, map[string]interface{}{
+		"name": "api-latency",
+		"condition": []interface{}{
+			map[string]interface{}{
+				"type":        "above",
+				"metric_name": "api.latency",
+				"tag": []interface{}{
+					map[string]interface{}{
+						"name":   "host",
+						"values": []interface{}{"web-*"},
+					},
+				},
+			},
+		},
+	})
+
+	libratoConfig := &Config{Backend: libratoBackendLibrato}
+	appOpticsConfig := &Config{Backend: libratoBackendAppOptics}
+	if err := libratoConfig.checkBackend("librato_alert", withSource); err != nil {
+		t.Fatalf("Sources should be accepted by the librato backend: %s", err)
+	}
+	if err := appOpticsConfig.checkBackend("librato_alert", withSource); err == nil {
+		t.Fatalf("Expected sources to be rejected by the appoptics backend")
+	}
+	if err := appOpticsConfig.checkBackend("librato_alert", withTags); err != nil {
+		t.Fatalf("Tags should be accepted by the appoptics backend: %s", err)
+	}
+}
+
+func TestResourceLibratoAlertConditionTags(t *testing.T) {
+	condition := resourceLibratoAlertConditionExpand(map[string]interface{}{
+		"type":        "above",
+		"metric_name": "api.latency",
+		"tag": []interface{}{
+			map[string]interface{}{
+				"name":    "region",
+				"grouped": true,
+				"values":  []interface{}{"us-east-1", "us-west-2"},
+			},
+		},
+	})
+	if len(condition.Tags) != 1 || *condition.Tags[0].Name != "region" || len(condition.Tags[0].Values) != 2 {
+		t.Fatalf("Bad condition tags: %#v", condition.Tags)
+	}
+
+	gathered := resourceLibratoAlertConditionsGather(nil, &Config{}, []librato.AlertCondition{condition})
+	tags := gathered[0].(map[string]interface{})["tag"].([]interface{})
+	if tag := tags[0].(map[string]interface{}); tag["name"] != "region" || tag["grouped"] != true {
+		t.Fatalf("Bad gathered tags: %#v", tags)
+	}
+}
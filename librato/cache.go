@@ -0,0 +1,179 @@
+package librato
+
+import (
+	"log"
+	"sync"
+
+	"github.com/henrikhodne/go-librato/librato"
+)
+
+// Metrics are read one by one until this many were read in the run, after
+// which all metrics are listed once. Listing an account with many metrics
+// takes longer than reading a few of them.
+const libratoMetricListThreshold = 25
+
+// libratoReadCache serves the reads of charts and metrics from list
+// responses, so that refreshing scales with the number of spaces rather than
+// the number of charts. It lives as long as the provider configuration.
+//
+// Objects changed by the provider are evicted, and objects missing from a
+// list are read individually, so a stale or eventually consistent list never
+// makes an object look deleted.
+type libratoReadCache struct {
+	client *librato.Client
+
+	mu     sync.Mutex
+	charts map[uint]*libratoChartCacheEntry
+
+	metricsMu   sync.Mutex
+	metricReads int
+	metrics     map[string]librato.Metric
+}
+
+type libratoChartCacheEntry struct {
+	once   sync.Once
+	charts map[uint]librato.SpaceChart
+	err    error
+}
+
+func newLibratoReadCache(client *librato.Client) *libratoReadCache {
+	return &libratoReadCache{
+		client: client,
+		charts: make(map[uint]*libratoChartCacheEntry),
+	}
+}
+
+// Returns a chart of a space, listing all charts of the space on first use.
+func (c *libratoReadCache) getChart(spaceID, chartID uint) (*librato.SpaceChart, error) {
+	charts, err := c.spaceCharts(spaceID)
+	if err != nil {
+		return nil, err
+	}
+	if chart, ok := charts[chartID]; ok {
+		return &chart, nil
+	}
+
+	chart, _, err := c.client.Spaces.GetChart(spaceID, chartID)
+	return chart, err
+}
+
+func (c *libratoReadCache) spaceCharts(spaceID uint) (map[uint]librato.SpaceChart, error) {
+	c.mu.Lock()
+	entry, ok := c.charts[spaceID]
+	if !ok {
+		entry = &libratoChartCacheEntry{}
+		c.charts[spaceID] = entry
+	}
+	c.mu.Unlock()
+
+	entry.once.Do(func() {
+		log.Printf("[INFO] Listing Librato charts of space %d", spaceID)
+		charts, _, err := c.client.Spaces.ListCharts(spaceID)
+		if err != nil {
+			entry.err = err
+			return
+		}
+		entry.charts = make(map[uint]librato.SpaceChart, len(charts))
+		for _, chart := range charts {
+			if chart.ID != nil {
+				entry.charts[*chart.ID] = chart
+			}
+		}
+	})
+
+	if entry.err != nil {
+		// Failed lists are retried by the next read
+		c.mu.Lock()
+		if c.charts[spaceID] == entry {
+			delete(c.charts, spaceID)
+		}
+		c.mu.Unlock()
+		return nil, entry.err
+	}
+	return entry.charts, nil
+}
+
+// Evicts a chart after it was changed. The cached list is shared by readers,
+// so it is replaced rather than changed.
+func (c *libratoReadCache) evictChart(spaceID, chartID uint) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.charts[spaceID]
+	if !ok {
+		return
+	}
+	entry.once.Do(func() {})
+	if entry.charts == nil {
+		delete(c.charts, spaceID)
+		return
+	}
+
+	charts := make(map[uint]librato.SpaceChart, len(entry.charts))
+	for id, chart := range entry.charts {
+		if id != chartID {
+			charts[id] = chart
+		}
+	}
+	replacement := &libratoChartCacheEntry{charts: charts}
+	replacement.once.Do(func() {})
+	c.charts[spaceID] = replacement
+}
+
+func (c *libratoReadCache) evictSpace(spaceID uint) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.charts, spaceID)
+}
+
+// Returns a metric, from the list of all metrics once enough metrics were
+// read.
+func (c *libratoReadCache) getMetric(name string) (*librato.Metric, error) {
+	c.metricsMu.Lock()
+	c.metricReads++
+	if c.metrics == nil && c.metricReads > libratoMetricListThreshold {
+		if err := c.listMetrics(); err != nil {
+			log.Printf("[WARN] Error listing Librato metrics, reading them one by one: %s", err)
+		}
+	}
+	metric, ok := c.metrics[name]
+	c.metricsMu.Unlock()
+
+	if ok {
+		return &metric, nil
+	}
+	m, _, err := c.client.Metrics.Get(name)
+	return m, err
+}
+
+// Pages through all metrics, must be called with metricsMu held.
+func (c *libratoReadCache) listMetrics() error {
+	log.Printf("[INFO] Listing Librato metrics")
+	metrics := make(map[string]librato.Metric)
+	opts := &librato.ListMetricsOptions{}
+	for {
+		page, resp, err := c.client.Metrics.List(opts)
+		if err != nil {
+			return err
+		}
+		for _, metric := range page {
+			if metric.Name != nil {
+				metrics[*metric.Name] = metric
+			}
+		}
+		if resp.NextPage == nil || len(page) == 0 {
+			break
+		}
+		next := opts.AdvancePage(resp.NextPage)
+		opts = &next
+	}
+
+	c.metrics = metrics
+	return nil
+}
+
+func (c *libratoReadCache) evictMetric(name string) {
+	c.metricsMu.Lock()
+	defer c.metricsMu.Unlock()
+	delete(c.metrics, name)
+}
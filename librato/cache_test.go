@@ -0,0 +1,111 @@
+package librato
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/henrikhodne/go-librato/librato"
+)
+
+func TestLibratoReadCacheCharts(t *testing.T) {
+	var mu sync.Mutex
+	requests := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/spaces/1/charts":
+			w.Write([]byte(`[{"id": 10, "name": "CPU"}, {"id": 11, "name": "Memory"}]`))
+		case "/spaces/1/charts/10":
+			w.Write([]byte(`{"id": 10, "name": "CPU (updated)"}`))
+		case "/spaces/1/charts/12":
+			w.Write([]byte(`{"id": 12, "name": "Disk"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{}`))
+		}
+	}))
+	defer server.Close()
+
+	baseURL, _ := url.Parse(server.URL + "/")
+	cache := newLibratoReadCache(librato.NewClientWithBaseURL(baseURL, "user", "token"))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(chartID uint) {
+			defer wg.Done()
+			if _, err := cache.getChart(1, chartID); err != nil {
+				t.Errorf("err: %s", err)
+			}
+		}(uint(10 + i%2))
+	}
+	wg.Wait()
+	if requests["/spaces/1/charts"] != 1 || len(requests) != 1 {
+		t.Fatalf("Expected the charts to be listed once, got %v", requests)
+	}
+
+	// Charts missing from the list are read individually
+	if chart, err := cache.getChart(1, 12); err != nil || stringValue(chart.Name) != "Disk" {
+		t.Fatalf("Bad chart missing from list: %v, %s", chart, err)
+	}
+
+	cache.evictChart(1, 10)
+	chart, err := cache.getChart(1, 10)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if stringValue(chart.Name) != "CPU (updated)" {
+		t.Fatalf("Evicted chart was served from the cache: %s", stringValue(chart.Name))
+	}
+	if requests["/spaces/1/charts"] != 1 {
+		t.Fatalf("Evicting a chart shouldn't list the charts again, got %v", requests)
+	}
+}
+
+func TestLibratoReadCacheMetrics(t *testing.T) {
+	var mu sync.Mutex
+	requests := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+		if r.URL.Path == "/metrics" {
+			w.Write([]byte(`{"query": {"offset": 0, "length": 2, "found": 2, "total": 2}, "metrics": [{"name": "a", "type": "gauge"}, {"name": "b", "type": "gauge"}]}`))
+			return
+		}
+		fmt.Fprintf(w, `{"name": "%s", "type": "gauge"}`, r.URL.Path[len("/metrics/"):])
+	}))
+	defer server.Close()
+
+	baseURL, _ := url.Parse(server.URL + "/")
+	cache := newLibratoReadCache(librato.NewClientWithBaseURL(baseURL, "user", "token"))
+
+	for i := 0; i < libratoMetricListThreshold; i++ {
+		cache.getMetric("a")
+	}
+	if requests["/metrics"] != 0 || requests["/metrics/a"] != libratoMetricListThreshold {
+		t.Fatalf("Expected metrics to be read one by one below the threshold, got %v", requests)
+	}
+
+	for i := 0; i < 10; i++ {
+		metric, err := cache.getMetric("b")
+		if err != nil || stringValue(metric.Name) != "b" {
+			t.Fatalf("Bad metric: %v, %s", metric, err)
+		}
+	}
+	if requests["/metrics"] != 1 || requests["/metrics/b"] != 0 {
+		t.Fatalf("Expected metrics to be listed once above the threshold, got %v", requests)
+	}
+
+	cache.evictMetric("b")
+	cache.getMetric("b")
+	if requests["/metrics/b"] != 1 {
+		t.Fatalf("Expected an evicted metric to be read individually, got %v", requests)
+	}
+}
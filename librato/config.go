@@ -0,0 +1,99 @@
+package librato
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/henrikhodne/go-librato/librato"
+)
+
+// Config is the provider configuration handed to every resource as meta.
+type Config struct {
+	Client *librato.Client
+
+	// Backend is the API the client talks to, librato or appoptics.
+	Backend string
+
+	// NamePrefix and NameSuffix are added to the names of the objects
+	// managed by the provider, so that the same configuration can be applied
+	// to several environments of one account. Metric names only get them
+	// when AffixMetricNames is set.
+	NamePrefix       string
+	NameSuffix       string
+	AffixMetricNames bool
+
+	// Policy holds the rules resources are checked against before they are
+	// created or updated.
+	Policy []*libratoPolicyRule
+
+	// ChangeAnnotations is set when applied changes are annotated.
+	ChangeAnnotations *libratoChangeAnnotations
+
+	cache *libratoReadCache
+}
+
+// Matches the metric name of s() and series() calls in a composite, in double
+// or single quotes
+var compositeMetricNameRegexp = regexp.MustCompile(`\b(s|series)\(\s*(?:"([^"]*)"|'([^']*)')`)
+
+// Returns the start and end of the metric name in the submatch indexes of a
+// compositeMetricNameRegexp match, whichever quotes it's in.
+func compositeMetricNameIndex(m []int) (int, int) {
+	if m[4] >= 0 {
+		return m[4], m[5]
+	}
+	return m[6], m[7]
+}
+
+func (c *Config) affixName(name string) string {
+	if name == "" {
+		return name
+	}
+	return c.NamePrefix + name + c.NameSuffix
+}
+
+// Strips the affixes from a name read from Librato. Names missing them are
+// returned unchanged.
+func (c *Config) stripName(name string) string {
+	if len(name) < len(c.NamePrefix)+len(c.NameSuffix) ||
+		!strings.HasPrefix(name, c.NamePrefix) || !strings.HasSuffix(name, c.NameSuffix) {
+		return name
+	}
+	return name[len(c.NamePrefix) : len(name)-len(c.NameSuffix)]
+}
+
+func (c *Config) affixMetricName(name string) string {
+	if !c.AffixMetricNames {
+		return name
+	}
+	return c.affixName(name)
+}
+
+func (c *Config) stripMetricName(name string) string {
+	if !c.AffixMetricNames {
+		return name
+	}
+	return c.stripName(name)
+}
+
+// Affixes the metric names referenced by a composite definition.
+func (c *Config) affixComposite(composite string) string {
+	if !c.AffixMetricNames {
+		return composite
+	}
+	return c.rewriteCompositeMetricNames(composite, c.affixName)
+}
+
+func (c *Config) stripComposite(composite string) string {
+	if !c.AffixMetricNames {
+		return composite
+	}
+	return c.rewriteCompositeMetricNames(composite, c.stripName)
+}
+
+func (c *Config) rewriteCompositeMetricNames(composite string, rewrite func(string) string) string {
+	return compositeMetricNameRegexp.ReplaceAllStringFunc(composite, func(call string) string {
+		start, end := compositeMetricNameIndex(compositeMetricNameRegexp.FindStringSubmatchIndex(call))
+		return call[:start] + rewrite(call[start:end]) + call[end:]
+	})
+}
@@ -0,0 +1,52 @@
+package librato
+
+import "testing"
+
+func TestConfigNameAffixes(t *testing.T) {
+	config := &Config{NamePrefix: "pr-42-", NameSuffix: " (preview)"}
+
+	if got := config.affixName("Dashboard"); got != "pr-42-Dashboard (preview)" {
+		t.Fatalf("Bad affixed name: %q", got)
+	}
+	if got := config.stripName("pr-42-Dashboard (preview)"); got != "Dashboard" {
+		t.Fatalf("Bad stripped name: %q", got)
+	}
+	if got := config.stripName("Dashboard"); got != "Dashboard" {
+		t.Fatalf("Name without affixes should be unchanged, got %q", got)
+	}
+	if got := config.affixMetricName("api.latency"); got != "api.latency" {
+		t.Fatalf("Metric names should only be affixed when enabled, got %q", got)
+	}
+}
+
+func TestConfigCompositeAffixes(t *testing.T) {
+	config := &Config{NamePrefix: "pr42.", AffixMetricNames: true}
+
+	cases := []struct {
+		composite, affixed string
+	}{
+		// Double quotes
+		{
+			`divide([sum(s("api.errors", "*")), sum(series("api.requests", {"env": "prod"}))])`,
+			`divide([sum(s("pr42.api.errors", "*")), sum(series("pr42.api.requests", {"env": "prod"}))])`,
+		},
+		// Single quotes
+		{
+			`divide([sum(s('api.errors', '*')), sum(series('api.requests', {'env': 'prod'}))])`,
+			`divide([sum(s('pr42.api.errors', '*')), sum(series('pr42.api.requests', {'env': 'prod'}))])`,
+		},
+		// Both, with a quote of the other style in the name
+		{
+			`sum([s("it's.errors", "*"), s( 'say."hi"', "*")])`,
+			`sum([s("pr42.it's.errors", "*"), s( 'pr42.say."hi"', "*")])`,
+		},
+	}
+	for _, c := range cases {
+		if got := config.affixComposite(c.composite); got != c.affixed {
+			t.Fatalf("Bad affixed composite: %s", got)
+		}
+		if got := config.stripComposite(c.affixed); got != c.composite {
+			t.Fatalf("Bad stripped composite: %s", got)
+		}
+	}
+}
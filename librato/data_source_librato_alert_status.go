@@ -0,0 +1,144 @@
+package librato
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/henrikhodne/go-librato/librato"
+)
+
+func dataSourceLibratoAlertStatus() *schema.Resource {
+	return &schema.Resource{
+		Read: dataSourceLibratoAlertStatusRead,
+
+		Schema: map[string]*schema.Schema{
+			"alert_id": {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+			"status": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"triggered": {
+				Type:     schema.TypeBool,
+				Computed: true,
+			},
+			"triggered_at": {
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+			"violating_sources": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+			"violation": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"source": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"metric": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"value": {
+							Type:     schema.TypeFloat,
+							Computed: true,
+						},
+						"recorded_at": {
+							Type:     schema.TypeInt,
+							Computed: true,
+						},
+						"condition_id": {
+							Type:     schema.TypeInt,
+							Computed: true,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func dataSourceLibratoAlertStatusRead(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*Config).Client
+
+	id, err := strconv.ParseUint(d.Get("alert_id").(string), 10, 0)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[INFO] Reading Librato Alert status: %d", id)
+	status, _, err := client.Alerts.Status(uint(id))
+	if err != nil {
+		return fmt.Errorf("Error reading Librato Alert status %d: %s", id, err)
+	}
+	log.Printf("[INFO] Received Librato Alert status: %s", *status)
+
+	d.SetId(strconv.FormatUint(id, 10))
+
+	state := ""
+	if status.Status != nil {
+		state = *status.Status
+	}
+	d.Set("status", state)
+	d.Set("triggered", state == "triggered")
+
+	triggeredAt := 0
+	if status.TriggeredAt != nil {
+		triggeredAt = int(*status.TriggeredAt)
+	}
+	d.Set("triggered_at", triggeredAt)
+
+	sources, violations := dataSourceLibratoAlertStatusViolationsGather(status.Violations)
+	if err := d.Set("violating_sources", sources); err != nil {
+		return err
+	}
+	if err := d.Set("violation", violations); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Flattens the violations of an alert status, sorted by source so that the
+// result is stable between reads.
+func dataSourceLibratoAlertStatusViolationsGather(violations map[string][]librato.AlertViolation) ([]string, []map[string]interface{}) {
+	sources := make([]string, 0, len(violations))
+	for source := range violations {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+
+	retViolations := make([]map[string]interface{}, 0, len(violations))
+	for _, source := range sources {
+		for _, v := range violations[source] {
+			violation := map[string]interface{}{
+				"source": source,
+			}
+			if v.Metric != nil {
+				violation["metric"] = *v.Metric
+			}
+			if v.Value != nil {
+				violation["value"] = *v.Value
+			}
+			if v.RecordedAt != nil {
+				violation["recorded_at"] = int(*v.RecordedAt)
+			}
+			if v.ConditionViolated != nil {
+				violation["condition_id"] = int(*v.ConditionViolated)
+			}
+			retViolations = append(retViolations, violation)
+		}
+	}
+
+	return sources, retViolations
+}
@@ -0,0 +1,50 @@
+package librato
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/acctest"
+	"github.com/hashicorp/terraform/helper/resource"
+)
+
+func TestAccDataSourceLibratoAlertStatus_Basic(t *testing.T) {
+	name := acctest.RandString(10)
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckLibratoAlertDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccCheckLibratoAlertStatusConfig_basic(name),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttrPair(
+						"data.librato_alert_status.foobar", "id", "librato_alert.foobar", "id"),
+					resource.TestCheckResourceAttr(
+						"data.librato_alert_status.foobar", "status", "ok"),
+					resource.TestCheckResourceAttr(
+						"data.librato_alert_status.foobar", "triggered", "false"),
+					resource.TestCheckResourceAttr(
+						"data.librato_alert_status.foobar", "violation.#", "0"),
+				),
+			},
+		},
+	})
+}
+
+func testAccCheckLibratoAlertStatusConfig_basic(name string) string {
+	return fmt.Sprintf(`
+resource "librato_alert" "foobar" {
+    name = "%s"
+    condition {
+      type = "above"
+      threshold = 1000000
+      metric_name = "librato.cpu.percent.idle"
+    }
+}
+
+data "librato_alert_status" "foobar" {
+    alert_id = "${librato_alert.foobar.id}"
+}`, name)
+}
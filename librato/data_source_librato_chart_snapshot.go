@@ -0,0 +1,126 @@
+package librato
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/henrikhodne/go-librato/librato"
+)
+
+func dataSourceLibratoChartSnapshot() *schema.Resource {
+	return &schema.Resource{
+		Read: dataSourceLibratoChartSnapshotRead,
+
+		Schema: map[string]*schema.Schema{
+			"space_id": {
+				Type:     schema.TypeInt,
+				Required: true,
+			},
+			"chart_id": {
+				Type:     schema.TypeInt,
+				Required: true,
+			},
+			"duration": {
+				Type:     schema.TypeInt,
+				Optional: true,
+				Default:  3600,
+			},
+			"end_time": {
+				Type:     schema.TypeInt,
+				Optional: true,
+			},
+			"source": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"href": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"image_href": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+		},
+	}
+}
+
+func dataSourceLibratoChartSnapshotRead(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*Config).Client
+
+	snapshot, id, err := libratoChartSnapshotRequest(client, d)
+	if err != nil {
+		return err
+	}
+
+	d.SetId(strconv.FormatUint(uint64(id), 10))
+	d.Set("href", stringValue(snapshot.Href))
+	d.Set("image_href", *snapshot.ImageHref)
+
+	return nil
+}
+
+// Requests a snapshot of the chart configured in d and waits until its image
+// is rendered.
+func libratoChartSnapshotRequest(client *librato.Client, d *schema.ResourceData) (*librato.Snapshot, uint, error) {
+	spaceID := uint(d.Get("space_id").(int))
+	chartID := uint(d.Get("chart_id").(int))
+
+	// Snapshots are rendered like the chart is displayed, so they need its type
+	chart, _, err := client.Spaces.GetChart(spaceID, chartID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("Error reading Librato space chart %d/%d: %s", spaceID, chartID, err)
+	}
+
+	request := &librato.SnapshotRequest{
+		Subject: &librato.SnapshotSubject{
+			Chart: &librato.SnapshotChart{
+				ID:   librato.Uint(chartID),
+				Type: chart.Type,
+			},
+		},
+		Duration: librato.Uint(uint(d.Get("duration").(int))),
+	}
+	if v, ok := d.GetOk("end_time"); ok {
+		request.EndTime = librato.Uint(uint(v.(int)))
+	}
+	if v, ok := d.GetOk("source"); ok {
+		request.Subject.Chart.Source = librato.String(v.(string))
+	}
+
+	log.Printf("[INFO] Requesting Librato snapshot of chart %d/%d", spaceID, chartID)
+	snapshot, _, err := client.Snapshots.Create(request)
+	if err != nil {
+		return nil, 0, fmt.Errorf("Error requesting Librato snapshot of chart %d/%d: %s", spaceID, chartID, err)
+	}
+	id, err := snapshot.ID()
+	if err != nil {
+		return nil, 0, fmt.Errorf("Error requesting Librato snapshot of chart %d/%d: %s", spaceID, chartID, err)
+	}
+
+	// Images are rendered asynchronously
+	err = resource.Retry(2*time.Minute, func() *resource.RetryError {
+		if snapshot.ImageHref != nil && *snapshot.ImageHref != "" {
+			return nil
+		}
+		log.Printf("[DEBUG] Waiting for Librato snapshot %d to be rendered", id)
+		var getErr error
+		snapshot, _, getErr = client.Snapshots.Get(id)
+		if getErr != nil {
+			return resource.NonRetryableError(getErr)
+		}
+		if snapshot.ImageHref == nil || *snapshot.ImageHref == "" {
+			return resource.RetryableError(fmt.Errorf("snapshot %d isn't rendered yet", id))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("Error waiting for Librato snapshot %d: %s", id, err)
+	}
+
+	return snapshot, id, nil
+}
@@ -0,0 +1,54 @@
+package librato
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/acctest"
+	"github.com/hashicorp/terraform/helper/resource"
+)
+
+func TestAccDataSourceLibratoChartSnapshot_Basic(t *testing.T) {
+	name := acctest.RandString(10)
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckLibratoSpaceDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccCheckLibratoChartSnapshotConfig_basic(name),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestMatchResourceAttr(
+						"data.librato_chart_snapshot.foobar", "image_href", regexp.MustCompile("^https://")),
+					resource.TestMatchResourceAttr(
+						"data.librato_chart_snapshot.foobar", "href", regexp.MustCompile("/snapshots/[0-9]+$")),
+				),
+			},
+		},
+	})
+}
+
+func testAccCheckLibratoChartSnapshotConfig_basic(name string) string {
+	return fmt.Sprintf(`
+resource "librato_space" "foobar" {
+    name = "%s"
+}
+
+resource "librato_space_chart" "foobar" {
+    space_id = "${librato_space.foobar.id}"
+    name = "%s"
+    type = "line"
+    stream {
+      metric = "librato.cpu.percent.idle"
+      source = "*"
+    }
+}
+
+data "librato_chart_snapshot" "foobar" {
+    space_id = "${librato_space.foobar.id}"
+    chart_id = "${librato_space_chart.foobar.id}"
+    duration = 600
+}`, name, name)
+}
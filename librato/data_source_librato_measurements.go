@@ -0,0 +1,268 @@
+package librato
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/henrikhodne/go-librato/librato"
+)
+
+func dataSourceLibratoMeasurements() *schema.Resource {
+	return &schema.Resource{
+		Read: dataSourceLibratoMeasurementsRead,
+
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				ConflictsWith: []string{"composite"},
+			},
+			"composite": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				ConflictsWith: []string{"name"},
+			},
+			"start_time": {
+				Type:          schema.TypeInt,
+				Optional:      true,
+				ConflictsWith: []string{"duration"},
+			},
+			"end_time": {
+				Type:     schema.TypeInt,
+				Optional: true,
+			},
+			"duration": {
+				Type:          schema.TypeInt,
+				Optional:      true,
+				ConflictsWith: []string{"start_time"},
+			},
+			"resolution": {
+				Type:     schema.TypeInt,
+				Optional: true,
+				Default:  60,
+			},
+			"source": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"tags": {
+				Type:     schema.TypeMap,
+				Optional: true,
+			},
+			"percentiles": {
+				Type:     schema.TypeList,
+				Optional: true,
+				Elem:     &schema.Schema{Type: schema.TypeFloat},
+			},
+			"percentile_values": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeFloat},
+			},
+			"measurement_count": {
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+			"min": {
+				Type:     schema.TypeFloat,
+				Computed: true,
+			},
+			"max": {
+				Type:     schema.TypeFloat,
+				Computed: true,
+			},
+			"mean": {
+				Type:     schema.TypeFloat,
+				Computed: true,
+			},
+			"p50": {
+				Type:     schema.TypeFloat,
+				Computed: true,
+			},
+			"p90": {
+				Type:     schema.TypeFloat,
+				Computed: true,
+			},
+			"p95": {
+				Type:     schema.TypeFloat,
+				Computed: true,
+			},
+			"p99": {
+				Type:     schema.TypeFloat,
+				Computed: true,
+			},
+			"series": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"tags": {
+							Type:     schema.TypeMap,
+							Computed: true,
+						},
+						"measurement": {
+							Type:     schema.TypeList,
+							Computed: true,
+							Elem: &schema.Resource{
+								Schema: map[string]*schema.Schema{
+									"time": {
+										Type:     schema.TypeInt,
+										Computed: true,
+									},
+									"value": {
+										Type:     schema.TypeFloat,
+										Computed: true,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func dataSourceLibratoMeasurementsRead(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*Config).Client
+
+	name := d.Get("name").(string)
+	opts := &librato.MeasurementsOptions{
+		Compose:    d.Get("composite").(string),
+		Resolution: uint(d.Get("resolution").(int)),
+		Tags:       make(map[string]string),
+	}
+	if name == "" && opts.Compose == "" {
+		return fmt.Errorf("One of name or composite must be set")
+	}
+
+	now := time.Now()
+	if v, ok := d.GetOk("end_time"); ok {
+		opts.EndTime = uint(v.(int))
+	}
+	if v, ok := d.GetOk("start_time"); ok {
+		opts.StartTime = uint(v.(int))
+	} else if v, ok := d.GetOk("duration"); ok {
+		opts.StartTime = uint(now.Add(-time.Duration(v.(int)) * time.Second).Unix())
+	} else {
+		return fmt.Errorf("One of start_time or duration must be set")
+	}
+
+	for k, v := range d.Get("tags").(map[string]interface{}) {
+		opts.Tags[k] = v.(string)
+	}
+	// Sources of legacy measurements are queried as the "source" tag
+	if v, ok := d.GetOk("source"); ok {
+		opts.Tags["source"] = v.(string)
+	}
+
+	var keys []string
+	series := make(map[string]*librato.MeasurementSeries)
+	for {
+		log.Printf("[INFO] Reading Librato measurements of %s%s from %d", name, opts.Compose, opts.StartTime)
+		page, resp, err := client.Metrics.Measurements(name, opts)
+		if err != nil {
+			return fmt.Errorf("Error reading Librato measurements: %s", err)
+		}
+
+		// Pages split the time range, so the same series shows up on every page
+		for i := range page {
+			key := dataSourceLibratoMeasurementsSeriesKey(page[i].Tags)
+			if s, ok := series[key]; ok {
+				s.Measurements = append(s.Measurements, page[i].Measurements...)
+				continue
+			}
+			keys = append(keys, key)
+			series[key] = &page[i]
+		}
+
+		if resp.NextTime == 0 || resp.NextTime <= opts.StartTime {
+			break
+		}
+		opts.StartTime = resp.NextTime
+	}
+
+	var values []float64
+	retSeries := make([]map[string]interface{}, 0, len(keys))
+	for _, key := range keys {
+		s := series[key]
+		measurements := make([]map[string]interface{}, 0, len(s.Measurements))
+		for _, m := range s.Measurements {
+			measurements = append(measurements, map[string]interface{}{
+				"time":  int(m.Time),
+				"value": m.Value,
+			})
+			values = append(values, m.Value)
+		}
+		retSeries = append(retSeries, map[string]interface{}{
+			"tags":        s.Tags,
+			"measurement": measurements,
+		})
+	}
+
+	d.SetId(now.UTC().String())
+	if err := d.Set("series", retSeries); err != nil {
+		return err
+	}
+
+	sort.Float64s(values)
+	d.Set("measurement_count", len(values))
+
+	percentiles := d.Get("percentiles").([]interface{})
+	percentileValues := make([]float64, len(percentiles))
+	for i, p := range percentiles {
+		percentileValues[i] = percentileOfSorted(values, p.(float64))
+	}
+	if err := d.Set("percentile_values", percentileValues); err != nil {
+		return err
+	}
+
+	if len(values) == 0 {
+		return nil
+	}
+
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	d.Set("min", values[0])
+	d.Set("max", values[len(values)-1])
+	d.Set("mean", sum/float64(len(values)))
+	d.Set("p50", percentileOfSorted(values, 50))
+	d.Set("p90", percentileOfSorted(values, 90))
+	d.Set("p95", percentileOfSorted(values, 95))
+	d.Set("p99", percentileOfSorted(values, 99))
+
+	return nil
+}
+
+func dataSourceLibratoMeasurementsSeriesKey(tags map[string]string) string {
+	pairs := make([]string, 0, len(tags))
+	for k, v := range tags {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// Returns the p-th percentile of sorted values, interpolating linearly between
+// the closest ranks.
+func percentileOfSorted(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	rank := p / 100 * float64(len(values)-1)
+	if rank <= 0 {
+		return values[0]
+	}
+	if rank >= float64(len(values)-1) {
+		return values[len(values)-1]
+	}
+	lo := math.Floor(rank)
+	return values[int(lo)] + (values[int(lo)+1]-values[int(lo)])*(rank-lo)
+}
@@ -0,0 +1,57 @@
+package librato
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/resource"
+)
+
+func TestAccDataSourceLibratoMeasurements_Basic(t *testing.T) {
+	resource.Test(t, resource.TestCase{
+		PreCheck:  func() { testAccPreCheck(t) },
+		Providers: testAccProviders,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccCheckLibratoMeasurementsConfig_basic,
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttrSet(
+						"data.librato_measurements.foobar", "measurement_count"),
+					resource.TestCheckResourceAttr(
+						"data.librato_measurements.foobar", "percentile_values.#", "1"),
+				),
+			},
+		},
+	})
+}
+
+func TestPercentileOfSorted(t *testing.T) {
+	values := []float64{1, 2, 3, 4, 5}
+
+	cases := []struct {
+		p    float64
+		want float64
+	}{
+		{0, 1},
+		{50, 3},
+		{90, 4.6},
+		{100, 5},
+	}
+
+	for _, c := range cases {
+		if got := percentileOfSorted(values, c.p); got != c.want {
+			t.Errorf("percentile %v: got %v, want %v", c.p, got, c.want)
+		}
+	}
+
+	if got := percentileOfSorted(nil, 99); got != 0 {
+		t.Errorf("percentile of no values: got %v, want 0", got)
+	}
+}
+
+const testAccCheckLibratoMeasurementsConfig_basic = `
+data "librato_measurements" "foobar" {
+    name = "librato.cpu.percent.idle"
+    duration = 3600
+    resolution = 60
+    percentiles = [ 99.9 ]
+}`
@@ -0,0 +1,183 @@
+package librato
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+// Applies configurations leaving the values the API defaults unset against
+// the fake API. Every step fails unless the plan right after the apply is
+// empty.
+func TestLibratoEmptyPlanAfterApply(t *testing.T) {
+	configs := map[string]string{
+		"space_chart":       testLibratoEmptyPlanConfig_spaceChart,
+		"metric":            testLibratoEmptyPlanConfig_metric,
+		"alert":             testLibratoEmptyPlanConfig_alert,
+		"alert_set":         testLibratoEmptyPlanConfig_alertSet,
+		"alert_clear":       testLibratoEmptyPlanConfig_alertClear,
+		"alert_maintenance": testLibratoEmptyPlanConfig_alertMaintenance,
+		"measurement":       testLibratoEmptyPlanConfig_measurement,
+		"slo":               testLibratoEmptyPlanConfig_slo,
+	}
+
+	for name, config := range configs {
+		api, server := newFakeLibratoAPI()
+		t.Run(name, func(t *testing.T) {
+			resource.UnitTest(t, resource.TestCase{
+				Providers:    testFakeLibratoProviders(server),
+				CheckDestroy: testCheckFakeLibratoAPIEmpty(api),
+				Steps: []resource.TestStep{
+					{
+						Config: testFakeLibratoProviderConfig + config,
+					},
+				},
+			})
+		})
+		server.Close()
+	}
+}
+
+func testCheckFakeLibratoAPIEmpty(api *fakeLibratoAPI) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		api.mu.Lock()
+		defer api.mu.Unlock()
+
+		var left []string
+		for k := range api.objects {
+			left = append(left, k)
+		}
+		if len(left) > 0 {
+			sort.Strings(left)
+			return fmt.Errorf("Objects left after destroy: %s", strings.Join(left, ", "))
+		}
+		return nil
+	}
+}
+
+const testLibratoEmptyPlanConfig_spaceChart = `
+resource "librato_space" "foobar" {
+    name = "Foo Bar"
+}
+
+resource "librato_space_chart" "foobar" {
+    space_id = "${librato_space.foobar.id}"
+    name = "Foo Bar"
+    type = "line"
+    min = 0
+
+    stream {
+      metric = "librato.cpu.percent.idle"
+      source = "*"
+    }
+    stream {
+      composite = "s(\"librato.cpu.percent.user\", \"*\")"
+      max = 100
+    }
+}`
+
+const testLibratoEmptyPlanConfig_metric = `
+resource "librato_metric" "gauge" {
+    name = "foo.bar.gauge"
+    type = "gauge"
+    deletion_protection = false
+    attributes {
+      color = "#a3c7e8"
+      display_min = 0
+    }
+}
+
+resource "librato_metric" "counter" {
+    name = "foo.bar.counter"
+    type = "counter"
+    deletion_protection = false
+}`
+
+const testLibratoEmptyPlanConfig_alert = `
+resource "librato_service" "foobar" {
+    title = "Foo Bar"
+    type = "mail"
+    settings = <<EOF
+{
+  "addresses": "admin@example.com"
+}
+EOF
+}
+
+resource "librato_alert" "foobar" {
+    name = "foo.bar"
+    services = [ "${librato_service.foobar.id}" ]
+    condition {
+      type = "above"
+      threshold = 10
+      metric_name = "librato.cpu.percent.idle"
+    }
+    condition {
+      type = "absent"
+      duration = 600
+      metric_name = "librato.cpu.percent.idle"
+    }
+}`
+
+const testLibratoEmptyPlanConfig_alertSet = `
+resource "librato_alert_set" "foobar" {
+    name = "queue.{{value}}"
+    values = [ "a", "b" ]
+    condition {
+      type = "above"
+      threshold = 1000
+      metric_name = "queue.depth"
+      source = "{{value}}"
+    }
+}`
+
+const testLibratoEmptyPlanConfig_alertClear = `
+resource "librato_alert" "foobar" {
+    name = "foo.bar"
+    condition {
+      type = "above"
+      threshold = 10
+      metric_name = "librato.cpu.percent.idle"
+    }
+}
+
+resource "librato_alert_clear" "foobar" {
+    alert_id = "${librato_alert.foobar.id}"
+    triggers {
+      threshold = "10"
+    }
+}`
+
+const testLibratoEmptyPlanConfig_alertMaintenance = `
+resource "librato_alert" "foobar" {
+    name = "foo.bar"
+}
+
+resource "librato_alert_maintenance" "foobar" {
+    alert_ids = [ "${librato_alert.foobar.id}" ]
+    duration = "1h"
+}`
+
+const testLibratoEmptyPlanConfig_measurement = `
+resource "librato_measurement" "foobar" {
+    tags {
+      host = "web-1"
+    }
+    measurement {
+      name = "foo.bar"
+      value = 1
+    }
+}`
+
+const testLibratoEmptyPlanConfig_slo = `
+resource "librato_slo" "foobar" {
+    name = "api"
+    good_metric = "api.requests.good"
+    total_metric = "api.requests.total"
+    target = 0.999
+    create_space = true
+}`
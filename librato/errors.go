@@ -0,0 +1,124 @@
+package librato
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/henrikhodne/go-librato/librato"
+)
+
+// The request parameters named differently from the attributes they are
+// expanded from.
+var libratoParamAttributes = map[string]string{
+	"conditions": "condition",
+	"streams":    "stream",
+	"tags":       "tag",
+}
+
+func libratoParamAttribute(param string) string {
+	if attribute, ok := libratoParamAttributes[param]; ok {
+		return attribute
+	}
+	return param
+}
+
+// Adds the attributes behind the parameter errors of a rejected request to
+// err, along with their configured values, so that e.g. the offending
+// condition of an alert can be told apart from the others. s is the schema of
+// the resource.
+func libratoAttributeError(d *schema.ResourceData, s map[string]*schema.Schema, err error) error {
+	errResp, ok := err.(*librato.ErrorResponse)
+	if !ok || !librato.IsValidation(err) {
+		return err
+	}
+
+	var lines []string
+	for _, paramErr := range errResp.ParamErrors() {
+		for _, attribute := range libratoParamErrorAttributes(d, s, paramErr) {
+			lines = append(lines, fmt.Sprintf("%s: %s", attribute, paramErr.Message))
+		}
+	}
+	if len(lines) == 0 {
+		return err
+	}
+	return fmt.Errorf("%s\n\n  %s", err, strings.Join(lines, "\n  "))
+}
+
+// Returns the attributes a parameter error is about, with their values. The
+// API names a rejected block by its position in the request, which follows the
+// order of the blocks in the state. When it doesn't, every block is returned.
+func libratoParamErrorAttributes(d *schema.ResourceData, s map[string]*schema.Schema, paramErr librato.ParamError) []string {
+	if len(paramErr.Path) == 0 {
+		return nil
+	}
+	key := libratoParamAttribute(paramErr.Path[0])
+	attributeSchema, ok := s[key]
+	if !ok {
+		return nil
+	}
+	block, ok := attributeSchema.Elem.(*schema.Resource)
+	if !ok {
+		return []string{libratoAttributeValue(key, d.Get(key), attributeSchema)}
+	}
+
+	var keys []string
+	var elems []map[string]interface{}
+	switch v := d.Get(key).(type) {
+	case *schema.Set:
+		for _, elem := range v.List() {
+			keys = append(keys, fmt.Sprintf("%s.%d", key, v.F(elem)))
+			elems = append(elems, elem.(map[string]interface{}))
+		}
+	case []interface{}:
+		for i, elem := range v {
+			if elem == nil {
+				continue
+			}
+			keys = append(keys, fmt.Sprintf("%s.%d", key, i))
+			elems = append(elems, elem.(map[string]interface{}))
+		}
+	}
+
+	path := paramErr.Path[1:]
+	if len(path) > 0 {
+		if i, err := strconv.Atoi(path[0]); err == nil {
+			if i < 0 || i >= len(elems) {
+				return nil
+			}
+			keys, elems = keys[i:i+1], elems[i:i+1]
+			path = path[1:]
+		}
+	}
+
+	// Messages like "threshold is invalid" name the field themselves
+	var field string
+	if len(path) > 0 {
+		field = libratoParamAttribute(path[0])
+	} else if words := strings.Fields(paramErr.Message); len(words) > 0 {
+		field = words[0]
+	}
+	fieldSchema, ok := block.Schema[field]
+	if !ok {
+		return keys
+	}
+
+	attributes := make([]string, 0, len(elems))
+	for i, elem := range elems {
+		attributes = append(attributes, libratoAttributeValue(keys[i]+"."+field, elem[field], fieldSchema))
+	}
+	return attributes
+}
+
+func libratoAttributeValue(key string, v interface{}, s *schema.Schema) string {
+	switch {
+	case s.Sensitive:
+		return key
+	case s.Type == schema.TypeString:
+		return fmt.Sprintf("%s = %q", key, v)
+	case s.Type == schema.TypeInt || s.Type == schema.TypeFloat || s.Type == schema.TypeBool:
+		return fmt.Sprintf("%s = %v", key, v)
+	}
+	return key
+}
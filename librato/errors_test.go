@@ -0,0 +1,86 @@
+package librato
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/henrikhodne/go-librato/librato"
+)
+
+func testLibratoErrorResponse(statusCode int, params map[string]interface{}) *librato.ErrorResponse {
+	req, _ := http.NewRequest("POST", "https://metrics-api.librato.com/v1/alerts", nil)
+	errResp := &librato.ErrorResponse{Response: &http.Response{StatusCode: statusCode, Request: req}}
+	errResp.Errors.Params = params
+	return errResp
+}
+
+func TestLibratoErrorHelpers(t *testing.T) {
+	cases := []struct {
+		err                               error
+		notFound, rateLimited, validation bool
+	}{
+		{testLibratoErrorResponse(404, nil), true, false, false},
+		{testLibratoErrorResponse(429, nil), false, true, false},
+		{testLibratoErrorResponse(400, nil), false, false, true},
+		{testLibratoErrorResponse(422, nil), false, false, true},
+		{testLibratoErrorResponse(500, nil), false, false, false},
+		{fmt.Errorf("connection reset"), false, false, false},
+		{nil, false, false, false},
+	}
+	for _, c := range cases {
+		if librato.IsNotFound(c.err) != c.notFound || librato.IsRateLimited(c.err) != c.rateLimited || librato.IsValidation(c.err) != c.validation {
+			t.Errorf("Bad classification of %v", c.err)
+		}
+	}
+}
+
+func TestLibratoAttributeError(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, resourceLibratoAlert().Schema, map[string]interface{}{
+		"name": "foo.bar",
+		"condition": []interface{}{
+			map[string]interface{}{"type": "above", "metric_name": "cpu", "threshold": 10},
+			map[string]interface{}{"type": "below", "metric_name": "cpu", "threshold": -1},
+		},
+	})
+	conditions := d.Get("condition").(*schema.Set)
+	second := conditions.List()[1].(map[string]interface{})
+	secondKey := fmt.Sprintf("condition.%d", conditions.F(second))
+
+	// Errors naming the condition point at it
+	err := libratoAttributeError(d, resourceLibratoAlert().Schema, testLibratoErrorResponse(400, map[string]interface{}{
+		"conditions": map[string]interface{}{
+			"1": map[string]interface{}{"threshold": []interface{}{"is invalid"}},
+		},
+	}))
+	expected := fmt.Sprintf("%s.threshold = %v: is invalid", secondKey, second["threshold"])
+	if !strings.HasSuffix(err.Error(), "\n\n  "+expected) {
+		t.Fatalf("Expected the error to end with %q, got: %s", expected, err)
+	}
+
+	// Errors only naming the field list every condition with its value
+	err = libratoAttributeError(d, resourceLibratoAlert().Schema, testLibratoErrorResponse(400, map[string]interface{}{
+		"conditions": []interface{}{"threshold is invalid"},
+		"name":       []interface{}{"is taken"},
+	}))
+	lines := strings.Split(err.Error(), "\n  ")[1:]
+	if len(lines) != 3 {
+		t.Fatalf("Expected 3 attributes in the error, got: %s", err)
+	}
+	for _, threshold := range []string{"10", "-1"} {
+		if !strings.Contains(lines[0]+"\n"+lines[1], fmt.Sprintf(".threshold = %s: threshold is invalid", threshold)) {
+			t.Fatalf("Expected the configured threshold %s in the error, got: %s", threshold, err)
+		}
+	}
+	if lines[2] != `name = "foo.bar": is taken` {
+		t.Fatalf("Bad name error: %q", lines[2])
+	}
+
+	// Other errors are left alone
+	notFound := testLibratoErrorResponse(404, nil)
+	if err := libratoAttributeError(d, resourceLibratoAlert().Schema, notFound); err != notFound {
+		t.Fatalf("Expected a not found error to be returned as is, got: %s", err)
+	}
+}
@@ -0,0 +1,332 @@
+package librato
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+// fakeLibratoAPI is an in-memory stand-in for the Librato API. It fills in
+// the defaults the API applies to objects it stores, so that tests can check
+// the provider doesn't show them as diffs.
+type fakeLibratoAPI struct {
+	mu      sync.Mutex
+	nextID  uint
+	objects map[string]map[string]interface{}
+
+	// Parameter errors returned for requests, by method and collection, e.g.
+	// "PUT charts"
+	rejections map[string]map[string]interface{}
+
+	// The most objects listed per page, unlimited when 0. Charts are only
+	// paginated when it is set.
+	pageSize int
+
+	// The method and path of every request served, e.g. "PUT alerts/1"
+	requests []string
+}
+
+// Makes the API reject requests with a method to a collection with parameter
+// errors.
+func (api *fakeLibratoAPI) reject(method, collection string, params map[string]interface{}) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	api.rejections[method+" "+collection] = params
+}
+
+// Responds with the parameter errors set up for a request, if any.
+func (api *fakeLibratoAPI) rejected(w http.ResponseWriter, r *http.Request, collection string) bool {
+	params, ok := api.rejections[r.Method+" "+collection]
+	if ok {
+		api.respond(w, http.StatusBadRequest, map[string]interface{}{
+			"errors": map[string]interface{}{"params": params},
+		})
+	}
+	return ok
+}
+
+func newFakeLibratoAPI() (*fakeLibratoAPI, *httptest.Server) {
+	api := &fakeLibratoAPI{
+		nextID:     1,
+		objects:    make(map[string]map[string]interface{}),
+		rejections: make(map[string]map[string]interface{}),
+	}
+	server := httptest.NewServer(api)
+	return api, server
+}
+
+// Returns providers using a server, for use with resource.UnitTest.
+func testFakeLibratoProviders(server *httptest.Server) map[string]terraform.ResourceProvider {
+	provider := Provider().(*schema.Provider)
+	provider.ConfigureFunc = func(d *schema.ResourceData) (interface{}, error) {
+		meta, err := providerConfigure(d)
+		if err != nil {
+			return nil, err
+		}
+		baseURL, err := url.Parse(server.URL + "/v1/")
+		if err != nil {
+			return nil, err
+		}
+		meta.(*Config).Client.BaseURL = baseURL
+		return meta, nil
+	}
+	return map[string]terraform.ResourceProvider{"librato": provider}
+}
+
+const testFakeLibratoProviderConfig = `
+provider "librato" {
+    email = "test@example.com"
+    token = "test"
+}
+`
+
+// Checks the names of the objects of a collection, e.g. "charts" for the
+// charts of every space.
+func testCheckFakeLibratoAPINames(api *fakeLibratoAPI, collection string, expected ...string) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		api.mu.Lock()
+		defer api.mu.Unlock()
+
+		var names []string
+		for k, object := range api.objects {
+			segments := strings.Split(k, "/")
+			if segments[len(segments)-2] == collection {
+				name, _ := object["name"].(string)
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		sort.Strings(expected)
+		if strings.Join(names, ", ") != strings.Join(expected, ", ") {
+			return fmt.Errorf("Bad %s names: %v, expected: %v", collection, names, expected)
+		}
+		return nil
+	}
+}
+
+func (api *fakeLibratoAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/v1/"), "/")
+	segments := strings.Split(path, "/")
+	api.requests = append(api.requests, r.Method+" "+path)
+
+	var body map[string]interface{}
+	if r.Body != nil {
+		json.NewDecoder(r.Body).Decode(&body)
+	}
+
+	switch {
+	case path == "measurements" || path == "annotations" || strings.HasPrefix(path, "annotations/"):
+		// Measurements of metrics named rejected.* are refused
+		measurements, _ := body["measurements"].([]interface{})
+		errors := []interface{}{}
+		for _, m := range measurements {
+			if name, _ := m.(map[string]interface{})["name"].(string); strings.HasPrefix(name, "rejected.") {
+				errors = append(errors, map[string]interface{}{"param": "name", "value": name, "reason": "is rejected"})
+			}
+		}
+		api.respond(w, http.StatusOK, map[string]interface{}{
+			"measurements": map[string]interface{}{
+				"summary": map[string]interface{}{
+					"total":    len(measurements),
+					"accepted": len(measurements) - len(errors),
+					"failed":   len(errors),
+				},
+			},
+			"errors": errors,
+		})
+	case len(segments) == 3 && segments[0] == "alerts" && segments[2] == "status":
+		if _, ok := api.objects["alerts/"+segments[1]]; !ok {
+			api.notFound(w)
+			return
+		}
+		id, _ := strconv.Atoi(segments[1])
+		api.respond(w, http.StatusOK, map[string]interface{}{
+			"alert":  map[string]interface{}{"id": id},
+			"status": "ok",
+		})
+	case len(segments) == 3 && segments[0] == "alerts" && segments[2] == "clear":
+		w.WriteHeader(http.StatusNoContent)
+	case len(segments)%2 == 1:
+		api.serveCollection(w, r, path, segments[len(segments)-1], body)
+	default:
+		api.serveObject(w, r, path, segments[len(segments)-2], body)
+	}
+}
+
+func (api *fakeLibratoAPI) serveCollection(w http.ResponseWriter, r *http.Request, path, collection string, body map[string]interface{}) {
+	if api.rejected(w, r, collection) {
+		return
+	}
+	switch r.Method {
+	case "POST":
+		id := api.nextID
+		api.nextID++
+		body["id"] = id
+		fakeLibratoDefaults(collection, body)
+		api.objects[fmt.Sprintf("%s/%d", path, id)] = body
+		api.respond(w, http.StatusCreated, body)
+	case "GET":
+		var keys []string
+		for k := range api.objects {
+			if strings.HasPrefix(k, path+"/") && !strings.Contains(strings.TrimPrefix(k, path+"/"), "/") {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		name := r.URL.Query().Get("name")
+		list := make([]interface{}, 0, len(keys))
+		for _, k := range keys {
+			if objectName, _ := api.objects[k]["name"].(string); strings.Contains(objectName, name) {
+				list = append(list, api.objects[k])
+			}
+		}
+		// Charts are listed without pagination
+		if collection == "charts" && api.pageSize == 0 {
+			api.respond(w, http.StatusOK, list)
+			return
+		}
+		found := len(list)
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		if offset > found {
+			offset = found
+		}
+		list = list[offset:]
+		if api.pageSize > 0 && len(list) > api.pageSize {
+			list = list[:api.pageSize]
+		}
+		api.respond(w, http.StatusOK, map[string]interface{}{
+			"query":    map[string]interface{}{"offset": offset, "length": len(list), "found": found, "total": found},
+			collection: list,
+		})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (api *fakeLibratoAPI) serveObject(w http.ResponseWriter, r *http.Request, path, collection string, body map[string]interface{}) {
+	if api.rejected(w, r, collection) {
+		return
+	}
+	object, ok := api.objects[path]
+	switch r.Method {
+	case "GET":
+		if !ok {
+			api.notFound(w)
+			return
+		}
+		api.respond(w, http.StatusOK, object)
+	case "PUT":
+		// Metrics are created by updating them
+		if !ok && collection != "metrics" {
+			api.notFound(w)
+			return
+		}
+		if !ok {
+			object = map[string]interface{}{}
+			api.objects[path] = object
+		}
+		for k, v := range body {
+			object[k] = v
+		}
+		fakeLibratoDefaults(collection, object)
+		w.WriteHeader(http.StatusNoContent)
+	case "DELETE":
+		if !ok {
+			api.notFound(w)
+			return
+		}
+		for k := range api.objects {
+			if k == path || strings.HasPrefix(k, path+"/") {
+				delete(api.objects, k)
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// Fills in the values the API defaults, and converts what it takes in one
+// form and returns in another.
+func fakeLibratoDefaults(collection string, object map[string]interface{}) {
+	setDefault := func(m map[string]interface{}, k string, v interface{}) {
+		if _, ok := m[k]; !ok {
+			m[k] = v
+		}
+	}
+
+	switch collection {
+	case "alerts":
+		setDefault(object, "active", true)
+		setDefault(object, "rearm_seconds", 600)
+		setDefault(object, "attributes", map[string]interface{}{})
+		conditions, _ := object["conditions"].([]interface{})
+		for _, c := range conditions {
+			condition := c.(map[string]interface{})
+			if condition["type"] != "absent" {
+				setDefault(condition, "summary_function", "average")
+			}
+			setDefault(condition, "detect_reset", false)
+		}
+		// Services are posted as IDs and returned as objects
+		services, _ := object["services"].([]interface{})
+		for i, s := range services {
+			switch s := s.(type) {
+			case string:
+				id, _ := strconv.Atoi(s)
+				services[i] = map[string]interface{}{"id": id}
+			case float64:
+				services[i] = map[string]interface{}{"id": s}
+			}
+		}
+		setDefault(object, "services", []interface{}{})
+	case "metrics":
+		setDefault(object, "period", 60)
+		attributes, _ := object["attributes"].(map[string]interface{})
+		if attributes == nil {
+			attributes = map[string]interface{}{}
+			object["attributes"] = attributes
+		}
+		setDefault(attributes, "created_by_ua", "librato-fake")
+		setDefault(attributes, "display_stacked", object["type"] == "counter")
+		setDefault(attributes, "gap_detection", false)
+		setDefault(attributes, "aggregate", false)
+	case "snapshots":
+		setDefault(object, "href", fmt.Sprintf("https://metrics-api.librato.com/v1/snapshots/%v", object["id"]))
+		setDefault(object, "image_href", fmt.Sprintf("https://snapshots.librato.com/chart/%v.png", object["id"]))
+	case "charts":
+		streams, _ := object["streams"].([]interface{})
+		for _, s := range streams {
+			stream := s.(map[string]interface{})
+			if _, ok := stream["metric"]; ok {
+				setDefault(stream, "group_function", "average")
+				setDefault(stream, "summary_function", "average")
+			}
+		}
+	}
+}
+
+func (api *fakeLibratoAPI) respond(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (api *fakeLibratoAPI) notFound(w http.ResponseWriter) {
+	api.respond(w, http.StatusNotFound, map[string]interface{}{
+		"errors": map[string]interface{}{"request": []string{"Not found"}},
+	})
+}
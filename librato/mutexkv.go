@@ -0,0 +1,52 @@
+package librato
+
+import (
+	"fmt"
+	"log"
+	"sync"
+)
+
+// libratoMutexKV is a registry of mutexes by key, for serializing operations
+// on one object while operations on others proceed in parallel.
+type libratoMutexKV struct {
+	lock  sync.Mutex
+	store map[string]*sync.Mutex
+}
+
+func newLibratoMutexKV() *libratoMutexKV {
+	return &libratoMutexKV{
+		store: make(map[string]*sync.Mutex),
+	}
+}
+
+func (m *libratoMutexKV) Lock(key string) {
+	log.Printf("[DEBUG] Locking %q", key)
+	m.get(key).Lock()
+	log.Printf("[DEBUG] Locked %q", key)
+}
+
+func (m *libratoMutexKV) Unlock(key string) {
+	log.Printf("[DEBUG] Unlocking %q", key)
+	m.get(key).Unlock()
+	log.Printf("[DEBUG] Unlocked %q", key)
+}
+
+func (m *libratoMutexKV) get(key string) *sync.Mutex {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	mutex, ok := m.store[key]
+	if !ok {
+		mutex = &sync.Mutex{}
+		m.store[key] = mutex
+	}
+	return mutex
+}
+
+// Chart changes within one space conflict when made concurrently, so they're
+// serialized per space. The registry is global, as providers configured with
+// aliases may manage charts of the same space.
+var libratoSpaceMutexKV = newLibratoMutexKV()
+
+func libratoSpaceLockKey(spaceID uint) string {
+	return fmt.Sprintf("librato_space/%d", spaceID)
+}
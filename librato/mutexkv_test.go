@@ -0,0 +1,79 @@
+package librato
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/henrikhodne/go-librato/librato"
+)
+
+func TestLibratoMutexKV(t *testing.T) {
+	m := newLibratoMutexKV()
+
+	m.Lock(libratoSpaceLockKey(1))
+	otherSpace := make(chan struct{})
+	go func() {
+		m.Lock(libratoSpaceLockKey(2))
+		m.Unlock(libratoSpaceLockKey(2))
+		close(otherSpace)
+	}()
+	select {
+	case <-otherSpace:
+	case <-time.After(time.Second):
+		t.Fatalf("Locking another space was blocked")
+	}
+
+	sameSpace := make(chan struct{})
+	go func() {
+		m.Lock(libratoSpaceLockKey(1))
+		m.Unlock(libratoSpaceLockKey(1))
+		close(sameSpace)
+	}()
+	select {
+	case <-sameSpace:
+		t.Fatalf("Locking the same space wasn't blocked")
+	case <-time.After(50 * time.Millisecond):
+	}
+	m.Unlock(libratoSpaceLockKey(1))
+	<-sameSpace
+}
+
+func TestLibratoClientMaxConcurrency(t *testing.T) {
+	var inFlight, maxInFlight int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&inFlight, -1)
+		w.Write([]byte(`{"id": 1}`))
+	}))
+	defer server.Close()
+
+	baseURL, _ := url.Parse(server.URL + "/")
+	client := librato.NewClientWithBaseURL(baseURL, "user", "token")
+	client.SetMaxConcurrency(2)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client.Spaces.Get(1)
+		}()
+	}
+	wg.Wait()
+
+	if maxInFlight > 2 {
+		t.Fatalf("Expected at most 2 requests in flight, got %d", maxInFlight)
+	}
+}
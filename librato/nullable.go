@@ -0,0 +1,58 @@
+package librato
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+// Schema of a number the API may leave unset, like the bounds of charts and
+// metrics. TypeFloat can't tell an unset value from 0, so the number is kept
+// as a string that is empty when unset.
+func libratoNullableFloatSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeString,
+		Optional: true,
+		ValidateFunc: func(v interface{}, k string) (ws []string, es []error) {
+			if s := v.(string); s != "" {
+				if _, err := strconv.ParseFloat(s, 64); err != nil {
+					es = append(es, fmt.Errorf("%q must be a number, got %q", k, s))
+				}
+			}
+			return
+		},
+		DiffSuppressFunc: suppressLibratoNullableFloatDiff,
+	}
+}
+
+// Numbers are written back the way the API formats them, so equal numbers
+// don't show a diff. States written before the bounds were nullable hold
+// "NaN" for unset values.
+func suppressLibratoNullableFloatDiff(k, old, new string, d *schema.ResourceData) bool {
+	o, n := libratoNullableFloatExpand(old), libratoNullableFloatExpand(new)
+	if o == nil || n == nil {
+		return o == nil && n == nil
+	}
+	return *o == *n
+}
+
+func libratoNullableFloatExpand(v interface{}) *float64 {
+	s, ok := v.(string)
+	if !ok || s == "" {
+		return nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) {
+		return nil
+	}
+	return &f
+}
+
+func libratoNullableFloatFlatten(f *float64) string {
+	if f == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*f, 'f', -1, 64)
+}
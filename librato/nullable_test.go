@@ -0,0 +1,23 @@
+package librato
+
+import "testing"
+
+func TestSuppressLibratoNullableFloatDiff(t *testing.T) {
+	cases := []struct {
+		old, new string
+		suppress bool
+	}{
+		{"", "", true},
+		{"NaN", "", true},
+		{"0", "", false},
+		{"", "0", false},
+		{"100", "1e2", true},
+		{"1.5", "1.50", true},
+		{"1.5", "2", false},
+	}
+	for _, c := range cases {
+		if suppress := suppressLibratoNullableFloatDiff("min", c.old, c.new, nil); suppress != c.suppress {
+			t.Errorf("Expected a diff from %q to %q to be suppressed: %t, got %t", c.old, c.new, c.suppress, suppress)
+		}
+	}
+}
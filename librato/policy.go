@@ -0,0 +1,290 @@
+package librato
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/henrikhodne/go-librato/librato"
+)
+
+// The resources policy rules can be written for, and the attribute naming
+// them in messages.
+var libratoPolicyResourceNames = map[string]string{
+	"librato_alert":       "name",
+	"librato_metric":      "name",
+	"librato_space_chart": "name",
+	"librato_service":     "title",
+}
+
+// A libratoPolicyRule constrains one attribute of a resource type. Nested
+// attributes are addressed with dots, e.g. "attributes.runbook_url", and a
+// rule on an attribute of a block applies to every block.
+type libratoPolicyRule struct {
+	ResourceType string   `json:"resource_type"`
+	Attribute    string   `json:"attribute"`
+	Required     bool     `json:"required"`
+	Min          *float64 `json:"min"`
+	MinItems     int      `json:"min_items"`
+	Pattern      string   `json:"pattern"`
+	Severity     string   `json:"severity"`
+
+	pattern *regexp.Regexp
+}
+
+func libratoPolicyRuleSchema() *schema.Resource {
+	return &schema.Resource{
+		Schema: map[string]*schema.Schema{
+			"resource_type": {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+			"attribute": {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+			"required": {
+				Type:     schema.TypeBool,
+				Optional: true,
+			},
+			// A string, as zero is a valid minimum
+			"min": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"min_items": {
+				Type:     schema.TypeInt,
+				Optional: true,
+			},
+			"pattern": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"severity": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Default:  "error",
+			},
+		},
+	}
+}
+
+// Reads the rules of the provider policy block and of the policy file.
+func libratoPolicyRulesExpand(d *schema.ResourceData) ([]*libratoPolicyRule, error) {
+	var rules []*libratoPolicyRule
+
+	for _, p := range d.Get("policy").([]interface{}) {
+		if p == nil {
+			continue
+		}
+		for _, r := range p.(map[string]interface{})["rule"].([]interface{}) {
+			ruleData := r.(map[string]interface{})
+			rule := &libratoPolicyRule{
+				ResourceType: ruleData["resource_type"].(string),
+				Attribute:    ruleData["attribute"].(string),
+				Required:     ruleData["required"].(bool),
+				MinItems:     ruleData["min_items"].(int),
+				Pattern:      ruleData["pattern"].(string),
+				Severity:     ruleData["severity"].(string),
+			}
+			if v := ruleData["min"].(string); v != "" {
+				var min float64
+				if _, err := fmt.Sscanf(v, "%g", &min); err != nil {
+					return nil, fmt.Errorf("Invalid min %q in policy rule for %s.%s", v, rule.ResourceType, rule.Attribute)
+				}
+				rule.Min = &min
+			}
+			rules = append(rules, rule)
+		}
+	}
+
+	if path := d.Get("policy_file").(string); path != "" {
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading policy file: %s", err)
+		}
+		var file struct {
+			Rules []*libratoPolicyRule `json:"rule"`
+		}
+		if err := json.Unmarshal(contents, &file); err != nil {
+			return nil, fmt.Errorf("Error decoding policy file %s: %s", path, err)
+		}
+		rules = append(rules, file.Rules...)
+	}
+
+	for _, rule := range rules {
+		if err := rule.init(); err != nil {
+			return nil, err
+		}
+	}
+
+	return rules, nil
+}
+
+func (r *libratoPolicyRule) init() error {
+	if _, ok := libratoPolicyResourceNames[r.ResourceType]; !ok {
+		return fmt.Errorf("Policy rules can't be written for resource type %q", r.ResourceType)
+	}
+	if r.Attribute == "" {
+		return fmt.Errorf("Policy rule for %s is missing an attribute", r.ResourceType)
+	}
+	switch r.Severity {
+	case "":
+		r.Severity = "error"
+	case "error", "warning":
+	default:
+		return fmt.Errorf("Policy rule for %s.%s has invalid severity %q, must be error or warning",
+			r.ResourceType, r.Attribute, r.Severity)
+	}
+	if r.Pattern != "" {
+		pattern, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return fmt.Errorf("Policy rule for %s.%s has invalid pattern: %s", r.ResourceType, r.Attribute, err)
+		}
+		r.pattern = pattern
+	}
+	return nil
+}
+
+// Evaluates the policy against the configuration of a resource. Violations of
+// warning rules are logged, violations of error rules fail with all of them
+// listed.
+func (c *Config) checkPolicy(resourceType string, d *schema.ResourceData) error {
+	name := fmt.Sprintf("%s %q", resourceType, d.Get(libratoPolicyResourceNames[resourceType]).(string))
+
+	var violations []string
+	for _, rule := range c.Policy {
+		if rule.ResourceType != resourceType {
+			continue
+		}
+		for _, v := range rule.check(d) {
+			message := fmt.Sprintf("%s: %s %s", name, rule.Attribute, v)
+			if rule.Severity == "warning" {
+				log.Printf("[WARN] Policy violation, %s", message)
+				continue
+			}
+			violations = append(violations, message)
+		}
+	}
+
+	if len(violations) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	for _, v := range violations {
+		fmt.Fprintf(&buf, "\n  * %s", v)
+	}
+	return fmt.Errorf("Policy violations:%s", buf.String())
+}
+
+// Evaluates the librato_alert rules against an alert rendered by another
+// resource, like the alerts of librato_alert_set and librato_slo, as if it
+// was configured as a librato_alert.
+func (c *Config) checkAlertPolicy(alert *librato.Alert) error {
+	d := resourceLibratoAlert().Data(nil)
+	d.Set("name", c.stripName(stringValue(alert.Name)))
+	d.Set("description", stringValue(alert.Description))
+	if alert.Active != nil {
+		d.Set("active", *alert.Active)
+	}
+	if alert.RearmSeconds != nil {
+		d.Set("rearm_seconds", int(*alert.RearmSeconds))
+	}
+	if services, ok := alert.Services.([]*string); ok {
+		d.Set("services", schema.NewSet(schema.HashString, libratoStringsFlatten(services)))
+	}
+	d.Set("condition", schema.NewSet(resourceLibratoAlertConditionsHash, resourceLibratoAlertConditionsGather(d, c, alert.Conditions)))
+	d.Set("attributes", resourceLibratoAlertAttributesGather(d, alert.Attributes))
+
+	return c.checkPolicy("librato_alert", d)
+}
+
+// Returns a description of every way the resource breaks the rule.
+func (r *libratoPolicyRule) check(d *schema.ResourceData) []string {
+	path := strings.Split(r.Attribute, ".")
+	// Unset attributes are left to the API, which fills in its own defaults,
+	// so only required and min_items apply to them
+	v, ok := d.GetOk(path[0])
+	if !ok {
+		v = nil
+	}
+	values := libratoPolicyValues(v, path[1:])
+
+	var violations []string
+	set := 0
+	for _, v := range values {
+		if !libratoPolicyIsZero(v) {
+			set++
+		}
+
+		switch v := v.(type) {
+		case nil:
+			if r.MinItems > 0 {
+				violations = append(violations, fmt.Sprintf("has 0 items, must have at least %d", r.MinItems))
+			}
+		case int:
+			if r.Min != nil && float64(v) < *r.Min {
+				violations = append(violations, fmt.Sprintf("is %d, must be at least %g", v, *r.Min))
+			}
+		case float64:
+			if r.Min != nil && v < *r.Min {
+				violations = append(violations, fmt.Sprintf("is %g, must be at least %g", v, *r.Min))
+			}
+		case string:
+			if r.pattern != nil && v != "" && !r.pattern.MatchString(v) {
+				violations = append(violations, fmt.Sprintf("is %q, must match %s", v, r.Pattern))
+			}
+		case []interface{}:
+			if len(v) < r.MinItems {
+				violations = append(violations, fmt.Sprintf("has %d items, must have at least %d", len(v), r.MinItems))
+			}
+		}
+	}
+
+	if r.Required && set == 0 {
+		violations = append(violations, "must be set")
+	}
+
+	return violations
+}
+
+// Collects the values found at path below v, descending into every element of
+// lists and sets.
+func libratoPolicyValues(v interface{}, path []string) []interface{} {
+	if s, ok := v.(*schema.Set); ok {
+		v = s.List()
+	}
+
+	if len(path) == 0 {
+		return []interface{}{v}
+	}
+
+	var values []interface{}
+	switch v := v.(type) {
+	case []interface{}:
+		for _, e := range v {
+			values = append(values, libratoPolicyValues(e, path)...)
+		}
+	case map[string]interface{}:
+		if e, ok := v[path[0]]; ok {
+			values = append(values, libratoPolicyValues(e, path[1:])...)
+		}
+	}
+	return values
+}
+
+func libratoPolicyIsZero(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	if l, ok := v.([]interface{}); ok {
+		return len(l) == 0
+	}
+	return reflect.DeepEqual(v, reflect.Zero(reflect.TypeOf(v)).Interface())
+}
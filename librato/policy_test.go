@@ -0,0 +1,170 @@
+package librato
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+func testLibratoPolicy(t *testing.T, rules ...*libratoPolicyRule) *Config {
+	for _, rule := range rules {
+		if err := rule.init(); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	return &Config{Policy: rules}
+}
+
+func TestConfigCheckPolicy_alert(t *testing.T) {
+	min := 300.0
+	config := testLibratoPolicy(t,
+		&libratoPolicyRule{ResourceType: "librato_alert", Attribute: "attributes.runbook_url", Required: true},
+		&libratoPolicyRule{ResourceType: "librato_alert", Attribute: "rearm_seconds", Min: &min},
+		&libratoPolicyRule{ResourceType: "librato_alert", Attribute: "services", MinItems: 1, Severity: "warning"},
+	)
+
+	d := schema.TestResourceDataRaw(t, resourceLibratoAlert().Schema, map[string]interface{}{
+		"name":          "cpu.high",
+		"rearm_seconds": 60,
+	})
+	err := config.checkPolicy("librato_alert", d)
+	if err == nil {
+		t.Fatalf("Expected policy violations")
+	}
+	for _, want := range []string{
+		`librato_alert "cpu.high": attributes.runbook_url must be set`,
+		`librato_alert "cpu.high": rearm_seconds is 60, must be at least 300`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("Expected %q in: %s", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), "services") {
+		t.Fatalf("Warnings shouldn't fail: %s", err)
+	}
+
+	d = schema.TestResourceDataRaw(t, resourceLibratoAlert().Schema, map[string]interface{}{
+		"name":          "cpu.high",
+		"rearm_seconds": 600,
+		"attributes": []interface{}{
+			map[string]interface{}{"runbook_url": "https://runbooks.example.com/cpu"},
+		},
+	})
+	if err := config.checkPolicy("librato_alert", d); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestConfigCheckPolicy_unset(t *testing.T) {
+	min := 300.0
+	config := testLibratoPolicy(t,
+		&libratoPolicyRule{ResourceType: "librato_alert", Attribute: "rearm_seconds", Min: &min},
+		&libratoPolicyRule{ResourceType: "librato_alert", Attribute: "services", MinItems: 1},
+	)
+
+	// rearm_seconds is left to the API
+	d := schema.TestResourceDataRaw(t, resourceLibratoAlert().Schema, map[string]interface{}{
+		"name": "cpu.high",
+	})
+	err := config.checkPolicy("librato_alert", d)
+	if err == nil || !strings.Contains(err.Error(), "services has 0 items, must have at least 1") {
+		t.Fatalf("Expected a min_items violation, got: %v", err)
+	}
+	if strings.Contains(err.Error(), "rearm_seconds") {
+		t.Fatalf("Expected an unset rearm_seconds to pass, got: %s", err)
+	}
+}
+
+func TestConfigCheckPolicy_pattern(t *testing.T) {
+	config := testLibratoPolicy(t,
+		&libratoPolicyRule{ResourceType: "librato_metric", Attribute: "name", Pattern: "^[a-z0-9_.]+$"},
+		&libratoPolicyRule{ResourceType: "librato_space_chart", Attribute: "stream.metric", Pattern: "^[a-z0-9_.]+$"},
+	)
+
+	d := schema.TestResourceDataRaw(t, resourceLibratoMetric().Schema, map[string]interface{}{
+		"name": "API-Latency",
+		"type": "gauge",
+	})
+	if err := config.checkPolicy("librato_metric", d); err == nil || !strings.Contains(err.Error(), "must match") {
+		t.Fatalf("Expected a pattern violation, got: %v", err)
+	}
+	// Rules only apply to their resource type
+	if err := config.checkPolicy("librato_service", schema.TestResourceDataRaw(t, resourceLibratoService().Schema, map[string]interface{}{})); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	d = schema.TestResourceDataRaw(t, resourceLibratoSpaceChart().Schema, map[string]interface{}{
+		"space_id": 1,
+		"name":     "Latency",
+		"stream": []interface{}{
+			map[string]interface{}{"metric": "api.latency"},
+			map[string]interface{}{"metric": "API.errors"},
+		},
+	})
+	err := config.checkPolicy("librato_space_chart", d)
+	if err == nil || !strings.Contains(err.Error(), `stream.metric is "API.errors"`) {
+		t.Fatalf("Expected a violation of the second stream, got: %v", err)
+	}
+}
+
+func TestConfigCheckAlertPolicy(t *testing.T) {
+	config := testLibratoPolicy(t,
+		&libratoPolicyRule{ResourceType: "librato_alert", Attribute: "attributes.runbook_url", Required: true},
+		&libratoPolicyRule{ResourceType: "librato_alert", Attribute: "condition.metric_name", Pattern: "^[a-z0-9_.]+$"},
+	)
+	config.NamePrefix = "staging."
+
+	// Alerts rendered by a librato_alert_set are checked per value
+	d := schema.TestResourceDataRaw(t, resourceLibratoAlertSet().Schema, map[string]interface{}{
+		"name":   "{{value}}.errors",
+		"values": []interface{}{"api", "web"},
+		"condition": []interface{}{
+			map[string]interface{}{"type": "above", "metric_name": "http.errors", "source": "{{value}}", "threshold": 10.0},
+		},
+		"attributes": []interface{}{
+			map[string]interface{}{"runbook_url": "https://runbooks.example.com/{{value}}"},
+		},
+	})
+	for _, value := range []string{"api", "web"} {
+		if err := config.checkAlertPolicy(resourceLibratoAlertSetExpand(config, d, value)); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	d.Set("attributes", nil)
+	err := config.checkAlertPolicy(resourceLibratoAlertSetExpand(config, d, "api"))
+	if err == nil || !strings.Contains(err.Error(), `librato_alert "api.errors": attributes.runbook_url must be set`) {
+		t.Fatalf("Expected a violation of the unprefixed alert, got: %v", err)
+	}
+
+	// The alerts of a librato_slo have no runbook
+	d = schema.TestResourceDataRaw(t, resourceLibratoSLO().Schema, map[string]interface{}{
+		"name":         "api.availability",
+		"good_metric":  "api.requests.good",
+		"total_metric": "api.requests.total",
+		"target":       0.999,
+	})
+	for _, b := range resourceLibratoSLOBurns(d) {
+		err := config.checkAlertPolicy(resourceLibratoSLOExpandAlert(config, d, b))
+		if err == nil || !strings.Contains(err.Error(), "attributes.runbook_url must be set") {
+			t.Fatalf("Expected a violation of the %s alert, got: %v", b.key, err)
+		}
+		if strings.Contains(err.Error(), "metric_name") {
+			t.Fatalf("Expected the unprefixed metric names to pass, got: %s", err)
+		}
+	}
+}
+
+func TestLibratoPolicyRuleInit(t *testing.T) {
+	cases := []*libratoPolicyRule{
+		{ResourceType: "librato_space", Attribute: "name"},
+		{ResourceType: "librato_alert"},
+		{ResourceType: "librato_alert", Attribute: "name", Severity: "fatal"},
+		{ResourceType: "librato_alert", Attribute: "name", Pattern: "("},
+	}
+	for _, rule := range cases {
+		if err := rule.init(); err == nil {
+			t.Fatalf("Expected rule %#v to be invalid", rule)
+		}
+	}
+}
@@ -3,7 +3,6 @@ package librato
 import (
 	"github.com/hashicorp/terraform/helper/schema"
 	"github.com/hashicorp/terraform/terraform"
-	"github.com/henrikhodne/go-librato/librato"
 )
 
 // Provider returns a schema.Provider for Librato.
@@ -12,9 +11,9 @@ func Provider() terraform.ResourceProvider {
 		Schema: map[string]*schema.Schema{
 			"email": &schema.Schema{
 				Type:        schema.TypeString,
-				Required:    true,
-				DefaultFunc: schema.EnvDefaultFunc("LIBRATO_EMAIL", nil),
-				Description: "The email address for the Librato account.",
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("LIBRATO_EMAIL", ""),
+				Description: "The email address for the Librato account, required for the librato backend.",
 			},
 
 			"token": &schema.Schema{
@@ -23,14 +22,111 @@ func Provider() terraform.ResourceProvider {
 				DefaultFunc: schema.EnvDefaultFunc("LIBRATO_TOKEN", nil),
 				Description: "The auth token for the Librato account.",
 			},
+
+			"backend": &schema.Schema{
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("LIBRATO_BACKEND", libratoBackendLibrato),
+				Description: "The API to manage, librato or appoptics.",
+			},
+
+			"name_prefix": &schema.Schema{
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("LIBRATO_NAME_PREFIX", ""),
+				Description: "A prefix added to the names of spaces, charts, alerts and services.",
+			},
+
+			"name_suffix": &schema.Schema{
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("LIBRATO_NAME_SUFFIX", ""),
+				Description: "A suffix added to the names of spaces, charts, alerts and services.",
+			},
+
+			"affix_metric_names": &schema.Schema{
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "Whether name_prefix and name_suffix are also added to metric names.",
+			},
+
+			"policy": &schema.Schema{
+				Type:     schema.TypeList,
+				Optional: true,
+				MaxItems: 1,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"rule": {
+							Type:     schema.TypeList,
+							Required: true,
+							Elem:     libratoPolicyRuleSchema(),
+						},
+					},
+				},
+				Description: "Rules resources are checked against when applying, before they are created or updated.",
+			},
+
+			"policy_file": &schema.Schema{
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("LIBRATO_POLICY_FILE", ""),
+				Description: "A JSON file of additional policy rules.",
+			},
+
+			"change_annotations": &schema.Schema{
+				Type:     schema.TypeList,
+				Optional: true,
+				MaxItems: 1,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"stream": {
+							Type:     schema.TypeString,
+							Required: true,
+						},
+						"link_env": {
+							Type:     schema.TypeString,
+							Optional: true,
+							Default:  "LIBRATO_CHANGE_URL",
+						},
+					},
+				},
+				Description: "Posts an annotation for every change applied to alerts, metrics and space charts.",
+			},
+
+			"audit_log_path": &schema.Schema{
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("LIBRATO_AUDIT_LOG_PATH", ""),
+				Description: "A file a JSON line is appended to for every change made through the API.",
+			},
+
+			"max_concurrent_requests": &schema.Schema{
+				Type:        schema.TypeInt,
+				Optional:    true,
+				Default:     0,
+				Description: "The maximum number of API requests in flight at once, 0 for no limit.",
+			},
+		},
+
+		DataSourcesMap: map[string]*schema.Resource{
+			"librato_alert_status":   dataSourceLibratoAlertStatus(),
+			"librato_chart_snapshot": dataSourceLibratoChartSnapshot(),
+			"librato_measurements":   dataSourceLibratoMeasurements(),
 		},
 
 		ResourcesMap: map[string]*schema.Resource{
-			"librato_space":       resourceLibratoSpace(),
-			"librato_space_chart": resourceLibratoSpaceChart(),
-			"librato_metric":      resourceLibratoMetric(),
-			"librato_alert":       resourceLibratoAlert(),
-			"librato_service":     resourceLibratoService(),
+			"librato_space":             resourceLibratoSpace(),
+			"librato_space_chart":       resourceLibratoSpaceChart(),
+			"librato_metric":            resourceLibratoMetric(),
+			"librato_measurement":       resourceLibratoMeasurement(),
+			"librato_alert":             resourceLibratoAlert(),
+			"librato_alert_set":         resourceLibratoAlertSet(),
+			"librato_alert_clear":       resourceLibratoAlertClear(),
+			"librato_alert_maintenance": resourceLibratoAlertMaintenance(),
+			"librato_chart_snapshot":    resourceLibratoChartSnapshot(),
+			"librato_service":           resourceLibratoService(),
+			"librato_slo":               resourceLibratoSLO(),
 		},
 
 		ConfigureFunc: providerConfigure,
@@ -38,7 +134,38 @@ func Provider() terraform.ResourceProvider {
 }
 
 func providerConfigure(d *schema.ResourceData) (interface{}, error) {
-	client := librato.NewClient(d.Get("email").(string), d.Get("token").(string))
+	backend := d.Get("backend").(string)
+	client, err := libratoNewClient(backend, d.Get("email").(string), d.Get("token").(string))
+	if err != nil {
+		return nil, err
+	}
+
+	config := &Config{
+		Client:           client,
+		Backend:          backend,
+		NamePrefix:       d.Get("name_prefix").(string),
+		NameSuffix:       d.Get("name_suffix").(string),
+		AffixMetricNames: d.Get("affix_metric_names").(bool),
+
+		ChangeAnnotations: libratoChangeAnnotationsExpand(d),
+	}
+
+	config.Client.SetMaxConcurrency(d.Get("max_concurrent_requests").(int))
+	config.cache = newLibratoReadCache(config.Client)
+
+	policy, err := libratoPolicyRulesExpand(d)
+	if err != nil {
+		return nil, err
+	}
+	config.Policy = policy
+
+	if path := d.Get("audit_log_path").(string); path != "" {
+		auditLog, err := newLibratoAuditLog(path)
+		if err != nil {
+			return nil, err
+		}
+		config.Client.Audit = auditLog.record
+	}
 
-	return client, nil
+	return config, nil
 }
@@ -29,7 +29,7 @@ func TestProvider_impl(t *testing.T) {
 }
 
 func testAccPreCheck(t *testing.T) {
-	if v := os.Getenv("LIBRATO_EMAIL"); v == "" {
+	if v := os.Getenv("LIBRATO_EMAIL"); v == "" && os.Getenv("LIBRATO_BACKEND") != libratoBackendAppOptics {
 		t.Fatal("LIBRATO_EMAIL must be set for acceptance tests")
 	}
 
@@ -0,0 +1,164 @@
+package librato
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/henrikhodne/go-librato/librato"
+)
+
+// How long find is polled for after a create with an unknown outcome, as an
+// object created by the lost request can take a while to be listed, and the
+// delay before the first poll, doubled after each one.
+var (
+	libratoRecoveryFindTimeout = 30 * time.Second
+	libratoRecoveryFindDelay   = 1 * time.Second
+)
+
+// Creates are plain POSTs which the client doesn't retry, since a POST whose
+// response was lost may still have created the object. After such a failure
+// find looks the object up, and it is adopted rather than created twice. The
+// create is only posted again when find keeps coming back empty.
+//
+// find returns the ID of the newest matching object with an ID above after, or
+// 0 when there is none. It's called once before the first POST, so that only
+// objects created since then are adopted and one with the same name that
+// existed before, e.g. managed by another configuration, never is.
+func libratoCreateWithRecovery(description string, create func() error, find func(after uint) (uint, error)) error {
+	existing, err := find(0)
+	if err != nil {
+		return fmt.Errorf("Error looking up existing Librato %s: %s", description, err)
+	}
+
+	return resource.Retry(2*time.Minute, func() *resource.RetryError {
+		err := create()
+		if err == nil {
+			return nil
+		}
+		if !librato.IsOutcomeUnknown(err) {
+			return resource.NonRetryableError(err)
+		}
+
+		log.Printf("[WARN] Outcome of creating Librato %s unknown, looking it up: %s", description, err)
+		found, findErr := libratoRecoveryFind(func() (bool, error) {
+			id, err := find(existing)
+			return id != 0, err
+		})
+		if findErr != nil {
+			return resource.NonRetryableError(fmt.Errorf("%s (looking up Librato %s failed: %s)", err, description, findErr))
+		}
+		if found {
+			log.Printf("[INFO] Found Librato %s created by the failed request, adopting it", description)
+			return nil
+		}
+
+		return resource.RetryableError(err)
+	})
+}
+
+// Polls find until it finds the object or libratoRecoveryFindTimeout passes.
+func libratoRecoveryFind(find func() (bool, error)) (bool, error) {
+	deadline := time.Now().Add(libratoRecoveryFindTimeout)
+	delay := libratoRecoveryFindDelay
+	for {
+		found, err := find()
+		if err != nil || found {
+			return found, err
+		}
+		if time.Now().Add(delay).After(deadline) {
+			return false, nil
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// The finders below return the most recently created match with an ID above
+// after, as a duplicate created by an earlier failed run would be older.
+
+func libratoFindSpace(client *librato.Client, name string, after uint) (*librato.Space, error) {
+	spaces, err := libratoListSpaces(client, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var found *librato.Space
+	for i, space := range spaces {
+		if space.Name == nil || *space.Name != name || space.ID == nil || *space.ID <= after {
+			continue
+		}
+		if found == nil || *space.ID > *found.ID {
+			found = &spaces[i]
+		}
+	}
+	return found, nil
+}
+
+func libratoFindAlert(client *librato.Client, name string, after uint) (*librato.Alert, error) {
+	alerts, err := libratoListAlerts(client, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var found *librato.Alert
+	for i, alert := range alerts {
+		if alert.Name == nil || *alert.Name != name || alert.ID == nil || *alert.ID <= after {
+			continue
+		}
+		if found == nil || *alert.ID > *found.ID {
+			found = &alerts[i]
+		}
+	}
+	return found, nil
+}
+
+func libratoFindSpaceChart(client *librato.Client, spaceID uint, name, chartType string, after uint) (*librato.SpaceChart, error) {
+	charts, _, err := client.Spaces.ListCharts(spaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	var found *librato.SpaceChart
+	for i, chart := range charts {
+		if chart.Name == nil || *chart.Name != name || chart.ID == nil || *chart.ID <= after {
+			continue
+		}
+		if chart.Type != nil && *chart.Type != chartType {
+			continue
+		}
+		if found == nil || *chart.ID > *found.ID {
+			found = &charts[i]
+		}
+	}
+	return found, nil
+}
+
+func libratoFindService(client *librato.Client, serviceType, title string, after uint) (*librato.Service, error) {
+	var found *librato.Service
+	opts := &librato.ListServicesOptions{}
+	for {
+		services, resp, err := client.Services.List(opts)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, service := range services {
+			if service.Title == nil || *service.Title != title || service.ID == nil || *service.ID <= after {
+				continue
+			}
+			if service.Type == nil || *service.Type != serviceType {
+				continue
+			}
+			if found == nil || *service.ID > *found.ID {
+				found = &services[i]
+			}
+		}
+
+		if resp.NextPage == nil || len(services) == 0 {
+			return found, nil
+		}
+		opts = &librato.ListServicesOptions{PaginationMeta: resp.NextPage}
+	}
+}
@@ -0,0 +1,196 @@
+package librato
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/henrikhodne/go-librato/librato"
+)
+
+func TestLibratoCreateWithRecovery(t *testing.T) {
+	creates, finds := 0, 0
+	err := libratoCreateWithRecovery("space test",
+		func() error {
+			creates++
+			return errors.New("net/http: timeout awaiting response headers")
+		},
+		func(after uint) (uint, error) {
+			finds++
+			return after + 1, nil
+		})
+	if err != nil {
+		t.Fatalf("Expected the created object to be adopted, got: %s", err)
+	}
+	if creates != 1 || finds != 2 {
+		t.Fatalf("Expected one create and two lookups, got %d and %d", creates, finds)
+	}
+
+	creates, finds = 0, 0
+	req, _ := http.NewRequest("POST", "https://metrics-api.librato.com/v1/spaces", nil)
+	err = libratoCreateWithRecovery("space test",
+		func() error {
+			creates++
+			return &librato.ErrorResponse{Response: &http.Response{StatusCode: 400, Request: req}}
+		},
+		func(after uint) (uint, error) {
+			finds++
+			return after + 1, nil
+		})
+	if err == nil {
+		t.Fatalf("Expected a validation error to fail the create")
+	}
+	if creates != 1 || finds != 1 {
+		t.Fatalf("Expected one create and only the lookup before it, got %d and %d", creates, finds)
+	}
+}
+
+func TestLibratoCreateWithRecovery_polling(t *testing.T) {
+	defer func(timeout, delay time.Duration) {
+		libratoRecoveryFindTimeout, libratoRecoveryFindDelay = timeout, delay
+	}(libratoRecoveryFindTimeout, libratoRecoveryFindDelay)
+	libratoRecoveryFindTimeout, libratoRecoveryFindDelay = 100*time.Millisecond, time.Millisecond
+
+	// The object shows up in the listing on the third lookup after the create
+	creates, finds := 0, 0
+	err := libratoCreateWithRecovery("space test",
+		func() error {
+			creates++
+			return errors.New("net/http: timeout awaiting response headers")
+		},
+		func(after uint) (uint, error) {
+			finds++
+			if finds == 4 {
+				return 1, nil
+			}
+			return 0, nil
+		})
+	if err != nil {
+		t.Fatalf("Expected the created object to be adopted, got: %s", err)
+	}
+	if creates != 1 || finds != 4 {
+		t.Fatalf("Expected one create and four lookups, got %d and %d", creates, finds)
+	}
+
+	// The create is posted again once the lookups give up
+	creates, finds = 0, 0
+	err = libratoCreateWithRecovery("space test",
+		func() error {
+			creates++
+			if creates == 1 {
+				return errors.New("net/http: timeout awaiting response headers")
+			}
+			return nil
+		},
+		func(after uint) (uint, error) {
+			finds++
+			return 0, nil
+		})
+	if err != nil {
+		t.Fatalf("Expected the create to be posted again, got: %s", err)
+	}
+	if creates != 2 || finds < 3 {
+		t.Fatalf("Expected two creates and several lookups, got %d and %d", creates, finds)
+	}
+}
+
+func TestLibratoCreateWithRecovery_existing(t *testing.T) {
+	defer func(timeout, delay time.Duration) {
+		libratoRecoveryFindTimeout, libratoRecoveryFindDelay = timeout, delay
+	}(libratoRecoveryFindTimeout, libratoRecoveryFindDelay)
+	libratoRecoveryFindTimeout, libratoRecoveryFindDelay = 10*time.Millisecond, time.Millisecond
+
+	api, server := newFakeLibratoAPI()
+	defer server.Close()
+	baseURL, _ := url.Parse(server.URL + "/v1/")
+	client := librato.NewClientWithBaseURL(baseURL, "user", "token")
+
+	existing, _, err := client.Spaces.Create(&librato.Space{Name: librato.String("space")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The response of the first POST is lost before it reaches the API, so the
+	// only space with the name is one that existed before
+	var space *librato.Space
+	creates := 0
+	find := func(after uint) (uint, error) {
+		found, err := libratoFindSpace(client, "space", after)
+		if found == nil {
+			return 0, err
+		}
+		space = found
+		return *found.ID, nil
+	}
+	err = libratoCreateWithRecovery("space space",
+		func() (err error) {
+			creates++
+			if creates == 1 {
+				return errors.New("net/http: timeout awaiting response headers")
+			}
+			space, _, err = client.Spaces.Create(&librato.Space{Name: librato.String("space")})
+			return err
+		}, find)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creates != 2 || *space.ID == *existing.ID {
+		t.Fatalf("Expected the existing space not to be adopted, got %d creates and space %d", creates, *space.ID)
+	}
+
+	// The POST creates the space but its response is lost, so it's adopted
+	// rather than the older ones
+	creates = 0
+	err = libratoCreateWithRecovery("space space",
+		func() error {
+			creates++
+			if _, _, err := client.Spaces.Create(&librato.Space{Name: librato.String("space")}); err != nil {
+				return err
+			}
+			return errors.New("net/http: timeout awaiting response headers")
+		}, find)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creates != 1 || *space.ID != api.nextID-1 {
+		t.Fatalf("Expected the new space to be adopted, got %d creates and space %d", creates, *space.ID)
+	}
+}
+
+func TestLibratoFind_paginated(t *testing.T) {
+	api, server := newFakeLibratoAPI()
+	defer server.Close()
+	api.pageSize = 2
+	baseURL, _ := url.Parse(server.URL + "/v1/")
+	client := librato.NewClientWithBaseURL(baseURL, "user", "token")
+
+	for i := 0; i < 5; i++ {
+		if _, _, err := client.Spaces.Create(&librato.Space{Name: librato.String(fmt.Sprintf("space %d", i))}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	space, err := libratoFindSpace(client, "space 4", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if space == nil || *space.ID != 5 {
+		t.Fatalf("Expected to find space 4 on the last page, got: %v", space)
+	}
+
+	for i := 0; i < 5; i++ {
+		chart := &librato.SpaceChart{Name: librato.String(fmt.Sprintf("chart %d", i)), Type: librato.String("line")}
+		if _, _, err := client.Spaces.CreateChart(*space.ID, chart); err != nil {
+			t.Fatal(err)
+		}
+	}
+	chart, err := libratoFindSpaceChart(client, *space.ID, "chart 4", "line", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chart == nil || *chart.Name != "chart 4" {
+		t.Fatalf("Expected to find chart 4 on the last page, got: %v", chart)
+	}
+}
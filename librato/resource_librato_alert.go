@@ -39,7 +39,17 @@ func resourceLibratoAlert() *schema.Resource {
 			"rearm_seconds": {
 				Type:     schema.TypeInt,
 				Optional: true,
-				Default:  600,
+				Computed: true,
+			},
+			"clear_on_update": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+			"deletion_protection": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
 			},
 			"services": {
 				Type:     schema.TypeSet,
@@ -64,6 +74,7 @@ func resourceLibratoAlert() *schema.Resource {
 							Type:     schema.TypeString,
 							Optional: true,
 						},
+						"tag": libratoTagSchema(false),
 						"detect_reset": {
 							Type:     schema.TypeBool,
 							Optional: true,
@@ -79,6 +90,7 @@ func resourceLibratoAlert() *schema.Resource {
 						"summary_function": {
 							Type:     schema.TypeString,
 							Optional: true,
+							Computed: true,
 						},
 					},
 				},
@@ -101,6 +113,8 @@ func resourceLibratoAlert() *schema.Resource {
 	}
 }
 
+const libratoAlertDefaultSummaryFunction = "average"
+
 func resourceLibratoAlertConditionsHash(v interface{}) int {
 	var buf bytes.Buffer
 	m := v.(map[string]interface{})
@@ -127,19 +141,73 @@ func resourceLibratoAlertConditionsHash(v interface{}) int {
 		buf.WriteString(fmt.Sprintf("%f-", threshold.(float64)))
 	}
 
-	summaryFunction, present := m["summary_function"]
-	if present {
-		buf.WriteString(fmt.Sprintf("%s-", summaryFunction.(string)))
+	// Threshold conditions are summarized by the average unless told otherwise
+	summaryFunction, _ := m["summary_function"].(string)
+	if summaryFunction == "" && m["type"] != "absent" {
+		summaryFunction = libratoAlertDefaultSummaryFunction
 	}
+	buf.WriteString(fmt.Sprintf("%s-", summaryFunction))
+
+	libratoTagsHash(&buf, m)
 
 	return hashcode.String(buf.String())
 }
 
+// Expands a single condition block into a librato.AlertCondition
+func resourceLibratoAlertConditionExpand(conditionData map[string]interface{}) librato.AlertCondition {
+	var condition librato.AlertCondition
+	if v, ok := conditionData["type"].(string); ok && v != "" {
+		condition.Type = librato.String(v)
+	}
+	if v, ok := conditionData["threshold"].(float64); ok && !math.IsNaN(v) {
+		condition.Threshold = librato.Float(v)
+	}
+	if v, ok := conditionData["metric_name"].(string); ok && v != "" {
+		condition.MetricName = librato.String(v)
+	}
+	if v, ok := conditionData["source"].(string); ok && v != "" {
+		condition.Source = librato.String(v)
+	}
+	if v, ok := conditionData["detect_reset"].(bool); ok {
+		condition.DetectReset = librato.Bool(v)
+	}
+	if v, ok := conditionData["duration"].(int); ok {
+		condition.Duration = librato.Uint(uint(v))
+	}
+	if v, ok := conditionData["summary_function"].(string); ok && v != "" {
+		condition.SummaryFunction = librato.String(v)
+	}
+	if tags, ok := conditionData["tag"].([]interface{}); ok {
+		for _, t := range tags {
+			tagData := t.(map[string]interface{})
+			tag := librato.AlertConditionTagSet{
+				Name: librato.String(tagData["name"].(string)),
+			}
+			if v, ok := tagData["grouped"].(bool); ok && v {
+				tag.Grouped = librato.Bool(v)
+			}
+			for _, tv := range tagData["values"].([]interface{}) {
+				tag.Values = append(tag.Values, librato.String(tv.(string)))
+			}
+			condition.Tags = append(condition.Tags, tag)
+		}
+	}
+	return condition
+}
+
 func resourceLibratoAlertCreate(d *schema.ResourceData, meta interface{}) error {
-	client := meta.(*librato.Client)
+	config := meta.(*Config)
+	client := config.Client
+
+	if err := config.checkPolicy("librato_alert", d); err != nil {
+		return err
+	}
+	if err := config.checkBackend("librato_alert", d); err != nil {
+		return err
+	}
 
 	alert := librato.Alert{
-		Name: librato.String(d.Get("name").(string)),
+		Name: librato.String(config.affixName(d.Get("name").(string))),
 	}
 	if v, ok := d.GetOk("description"); ok {
 		alert.Description = librato.String(v.(string))
@@ -161,30 +229,10 @@ func resourceLibratoAlertCreate(d *schema.ResourceData, meta interface{}) error
 		vs := v.(*schema.Set)
 		conditions := make([]librato.AlertCondition, vs.Len())
 		for i, conditionDataM := range vs.List() {
-			conditionData := conditionDataM.(map[string]interface{})
-			var condition librato.AlertCondition
-			if v, ok := conditionData["type"].(string); ok && v != "" {
-				condition.Type = librato.String(v)
-			}
-			if v, ok := conditionData["threshold"].(float64); ok && !math.IsNaN(v) {
-				condition.Threshold = librato.Float(v)
-			}
-			if v, ok := conditionData["metric_name"].(string); ok && v != "" {
-				condition.MetricName = librato.String(v)
-			}
-			if v, ok := conditionData["source"].(string); ok && v != "" {
-				condition.Source = librato.String(v)
+			conditions[i] = resourceLibratoAlertConditionExpand(conditionDataM.(map[string]interface{}))
+			if conditions[i].MetricName != nil {
+				conditions[i].MetricName = librato.String(config.affixMetricName(*conditions[i].MetricName))
 			}
-			if v, ok := conditionData["detect_reset"].(bool); ok {
-				condition.DetectReset = librato.Bool(v)
-			}
-			if v, ok := conditionData["duration"].(int); ok {
-				condition.Duration = librato.Uint(uint(v))
-			}
-			if v, ok := conditionData["summary_function"].(string); ok && v != "" {
-				condition.SummaryFunction = librato.String(v)
-			}
-			conditions[i] = condition
 		}
 		alert.Conditions = conditions
 	}
@@ -205,17 +253,29 @@ func resourceLibratoAlertCreate(d *schema.ResourceData, meta interface{}) error
 		}
 	}
 
-	alertResult, _, err := client.Alerts.Create(&alert)
-
+	var alertResult *librato.Alert
+	err := libratoCreateWithRecovery(fmt.Sprintf("alert %s", *alert.Name),
+		func() (err error) {
+			alertResult, _, err = client.Alerts.Create(&alert)
+			return err
+		},
+		func(after uint) (uint, error) {
+			found, err := libratoFindAlert(client, *alert.Name, after)
+			if found == nil {
+				return 0, err
+			}
+			alertResult = found
+			return *found.ID, nil
+		})
 	if err != nil {
-		return fmt.Errorf("Error creating Librato alert %s: %s", *alert.Name, err)
+		return fmt.Errorf("Error creating Librato alert %s: %s", *alert.Name, libratoAttributeError(d, resourceLibratoAlert().Schema, err))
 	}
 	log.Printf("[INFO] Created Librato alert: %s", *alertResult)
 
 	retryErr := resource.Retry(1*time.Minute, func() *resource.RetryError {
 		_, _, err := client.Alerts.Get(*alertResult.ID)
 		if err != nil {
-			if errResp, ok := err.(*librato.ErrorResponse); ok && errResp.Response.StatusCode == 404 {
+			if librato.IsNotFound(err) {
 				return resource.RetryableError(err)
 			}
 			return resource.NonRetryableError(err)
@@ -227,12 +287,14 @@ func resourceLibratoAlertCreate(d *schema.ResourceData, meta interface{}) error
 	}
 
 	d.SetId(strconv.FormatUint(uint64(*alertResult.ID), 10))
+	config.annotateChange(d, "librato_alert", "created", *alertResult.Name, nil)
 
 	return resourceLibratoAlertRead(d, meta)
 }
 
 func resourceLibratoAlertRead(d *schema.ResourceData, meta interface{}) error {
-	client := meta.(*librato.Client)
+	config := meta.(*Config)
+	client := config.Client
 	id, err := strconv.ParseUint(d.Id(), 10, 0)
 	if err != nil {
 		return err
@@ -241,7 +303,7 @@ func resourceLibratoAlertRead(d *schema.ResourceData, meta interface{}) error {
 	log.Printf("[INFO] Reading Librato Alert: %d", id)
 	alert, _, err := client.Alerts.Get(uint(id))
 	if err != nil {
-		if errResp, ok := err.(*librato.ErrorResponse); ok && errResp.Response.StatusCode == 404 {
+		if librato.IsNotFound(err) {
 			d.SetId("")
 			return nil
 		}
@@ -249,7 +311,7 @@ func resourceLibratoAlertRead(d *schema.ResourceData, meta interface{}) error {
 	}
 	log.Printf("[INFO] Received Librato Alert: %s", *alert)
 
-	d.Set("name", alert.Name)
+	d.Set("name", config.stripName(*alert.Name))
 
 	if alert.Description != nil {
 		if err := d.Set("description", alert.Description); err != nil {
@@ -257,7 +319,11 @@ func resourceLibratoAlertRead(d *schema.ResourceData, meta interface{}) error {
 		}
 	}
 	if alert.Active != nil {
-		if err := d.Set("active", alert.Active); err != nil {
+		// An alert deactivated by an open librato_alert_maintenance window keeps
+		// its configured state, so the window doesn't show up as a diff
+		if until := libratoAlertMaintenanceUntil(alert); until.After(time.Now()) {
+			log.Printf("[INFO] Librato Alert %d is in maintenance until %s", id, until)
+		} else if err := d.Set("active", alert.Active); err != nil {
 			return err
 		}
 	}
@@ -274,7 +340,7 @@ func resourceLibratoAlertRead(d *schema.ResourceData, meta interface{}) error {
 		return err
 	}
 
-	conditions := resourceLibratoAlertConditionsGather(d, alert.Conditions)
+	conditions := resourceLibratoAlertConditionsGather(d, config, alert.Conditions)
 	if err := d.Set("condition", schema.NewSet(resourceLibratoAlertConditionsHash, conditions)); err != nil {
 		return err
 	}
@@ -299,7 +365,7 @@ func resourceLibratoAlertServicesGather(d *schema.ResourceData, services []inter
 	return retServices
 }
 
-func resourceLibratoAlertConditionsGather(d *schema.ResourceData, conditions []librato.AlertCondition) []interface{} {
+func resourceLibratoAlertConditionsGather(d *schema.ResourceData, config *Config, conditions []librato.AlertCondition) []interface{} {
 	retConditions := make([]interface{}, 0, len(conditions))
 	for _, c := range conditions {
 		condition := make(map[string]interface{})
@@ -310,13 +376,13 @@ func resourceLibratoAlertConditionsGather(d *schema.ResourceData, conditions []l
 			condition["threshold"] = *c.Threshold
 		}
 		if c.MetricName != nil {
-			condition["metric_name"] = *c.MetricName
+			condition["metric_name"] = config.stripMetricName(*c.MetricName)
 		}
 		if c.Source != nil {
 			condition["source"] = *c.Source
 		}
 		if c.DetectReset != nil {
-			condition["detect_reset"] = *c.MetricName
+			condition["detect_reset"] = *c.DetectReset
 		}
 		if c.Duration != nil {
 			condition["duration"] = int(*c.Duration)
@@ -324,6 +390,20 @@ func resourceLibratoAlertConditionsGather(d *schema.ResourceData, conditions []l
 		if c.SummaryFunction != nil {
 			condition["summary_function"] = *c.SummaryFunction
 		}
+		if len(c.Tags) > 0 {
+			tags := make([]interface{}, 0, len(c.Tags))
+			for _, t := range c.Tags {
+				tag := map[string]interface{}{
+					"name":   stringValue(t.Name),
+					"values": libratoStringsFlatten(t.Values),
+				}
+				if t.Grouped != nil {
+					tag["grouped"] = *t.Grouped
+				}
+				tags = append(tags, tag)
+			}
+			condition["tag"] = tags
+		}
 		retConditions = append(retConditions, condition)
 	}
 
@@ -334,27 +414,42 @@ func resourceLibratoAlertConditionsGather(d *schema.ResourceData, conditions []l
 func resourceLibratoAlertAttributesGather(d *schema.ResourceData, attributes *librato.AlertAttributes) []map[string]interface{} {
 	result := make([]map[string]interface{}, 0, 1)
 
-	if attributes != nil {
-		retAttributes := make(map[string]interface{})
-		if attributes.RunbookURL != nil {
-			retAttributes["runbook_url"] = *attributes.RunbookURL
-		}
-		result = append(result, retAttributes)
+	// The API returns empty attributes for alerts without any, and the
+	// maintenance window marker alone is not something configured by the user
+	if attributes != nil && attributes.RunbookURL != nil {
+		result = append(result, map[string]interface{}{
+			"runbook_url": *attributes.RunbookURL,
+		})
 	}
 
 	return result
 }
 
 func resourceLibratoAlertUpdate(d *schema.ResourceData, meta interface{}) error {
-	client := meta.(*librato.Client)
+	config := meta.(*Config)
+	client := config.Client
+
+	if err := config.checkPolicy("librato_alert", d); err != nil {
+		return err
+	}
+	if err := config.checkBackend("librato_alert", d); err != nil {
+		return err
+	}
 
 	id, err := strconv.ParseUint(d.Id(), 10, 0)
 	if err != nil {
 		return err
 	}
 
+	// deletion_protection and clear_on_update only live in the state
+	if !d.HasChange("name") && !d.HasChange("description") && !d.HasChange("active") &&
+		!d.HasChange("rearm_seconds") && !d.HasChange("services") && !d.HasChange("condition") &&
+		!d.HasChange("attributes") {
+		return resourceLibratoAlertRead(d, meta)
+	}
+
 	alert := new(librato.Alert)
-	alert.Name = librato.String(d.Get("name").(string))
+	alert.Name = librato.String(config.affixName(d.Get("name").(string)))
 
 	if d.HasChange("description") {
 		alert.Description = librato.String(d.Get("description").(string))
@@ -377,30 +472,10 @@ func resourceLibratoAlertUpdate(d *schema.ResourceData, meta interface{}) error
 	vs := d.Get("condition").(*schema.Set)
 	conditions := make([]librato.AlertCondition, vs.Len())
 	for i, conditionDataM := range vs.List() {
-		conditionData := conditionDataM.(map[string]interface{})
-		var condition librato.AlertCondition
-		if v, ok := conditionData["type"].(string); ok && v != "" {
-			condition.Type = librato.String(v)
-		}
-		if v, ok := conditionData["threshold"].(float64); ok && !math.IsNaN(v) {
-			condition.Threshold = librato.Float(v)
-		}
-		if v, ok := conditionData["metric_name"].(string); ok && v != "" {
-			condition.MetricName = librato.String(v)
-		}
-		if v, ok := conditionData["source"].(string); ok && v != "" {
-			condition.Source = librato.String(v)
+		conditions[i] = resourceLibratoAlertConditionExpand(conditionDataM.(map[string]interface{}))
+		if conditions[i].MetricName != nil {
+			conditions[i].MetricName = librato.String(config.affixMetricName(*conditions[i].MetricName))
 		}
-		if v, ok := conditionData["detect_reset"].(bool); ok {
-			condition.DetectReset = librato.Bool(v)
-		}
-		if v, ok := conditionData["duration"].(int); ok {
-			condition.Duration = librato.Uint(uint(v))
-		}
-		if v, ok := conditionData["summary_function"].(string); ok && v != "" {
-			condition.SummaryFunction = librato.String(v)
-		}
-		conditions[i] = condition
 		alert.Conditions = conditions
 	}
 	if d.HasChange("attributes") {
@@ -413,13 +488,21 @@ func resourceLibratoAlertUpdate(d *schema.ResourceData, meta interface{}) error
 		if v, ok := attributeDataMap["runbook_url"].(string); ok && v != "" {
 			attributes.RunbookURL = librato.String(v)
 		}
+		// Attributes are replaced as a whole, keep any open maintenance window
+		currentAlert, _, err := client.Alerts.Get(uint(id))
+		if err != nil {
+			return fmt.Errorf("Error reading Librato Alert %d: %s", id, err)
+		}
+		if currentAlert.Attributes != nil {
+			attributes.MaintenanceUntil = currentAlert.Attributes.MaintenanceUntil
+		}
 		alert.Attributes = attributes
 	}
 
 	log.Printf("[INFO] Updating Librato alert: %s", alert)
 	_, updErr := client.Alerts.Update(uint(id), alert)
 	if updErr != nil {
-		return fmt.Errorf("Error updating Librato alert: %s", updErr)
+		return fmt.Errorf("Error updating Librato alert: %s", libratoAttributeError(d, resourceLibratoAlert().Schema, updErr))
 	}
 
 	log.Printf("[INFO] Updated Librato alert %d", id)
@@ -446,16 +529,41 @@ func resourceLibratoAlertUpdate(d *schema.ResourceData, meta interface{}) error
 		return fmt.Errorf("Failed updating Librato Alert %d: %s", id, err)
 	}
 
+	if d.Get("clear_on_update").(bool) && d.HasChange("condition") {
+		if err := resourceLibratoAlertClearTriggered(client, uint(id)); err != nil {
+			return err
+		}
+	}
+	config.annotateChange(d, "librato_alert", "updated", *alert.Name, resourceLibratoAlert().Schema)
+
 	return resourceLibratoAlertRead(d, meta)
 }
 
+// Clears an alert that may still be triggered by conditions that no longer
+// apply.
+func resourceLibratoAlertClearTriggered(client *librato.Client, id uint) error {
+	log.Printf("[INFO] Clearing Librato alert %d", id)
+	if _, err := client.Alerts.Clear(id); err != nil {
+		return fmt.Errorf("Error clearing Librato alert %d: %s", id, err)
+	}
+	log.Printf("[INFO] Cleared Librato alert %d", id)
+
+	return nil
+}
+
 func resourceLibratoAlertDelete(d *schema.ResourceData, meta interface{}) error {
-	client := meta.(*librato.Client)
+	config := meta.(*Config)
+	client := config.Client
 	id, err := strconv.ParseUint(d.Id(), 10, 0)
 	if err != nil {
 		return err
 	}
 
+	if d.Get("deletion_protection").(bool) {
+		return fmt.Errorf("Librato alert %d has deletion_protection enabled, set "+
+			"deletion_protection = false and apply before destroying it", id)
+	}
+
 	log.Printf("[INFO] Deleting Alert: %d", id)
 	_, err = client.Alerts.Delete(uint(id))
 	if err != nil {
@@ -465,7 +573,7 @@ func resourceLibratoAlertDelete(d *schema.ResourceData, meta interface{}) error
 	retryErr := resource.Retry(1*time.Minute, func() *resource.RetryError {
 		_, _, err := client.Alerts.Get(uint(id))
 		if err != nil {
-			if errResp, ok := err.(*librato.ErrorResponse); ok && errResp.Response.StatusCode == 404 {
+			if librato.IsNotFound(err) {
 				return nil
 			}
 			return resource.NonRetryableError(err)
@@ -475,6 +583,41 @@ func resourceLibratoAlertDelete(d *schema.ResourceData, meta interface{}) error
 	if retryErr != nil {
 		return fmt.Errorf("Error deleting librato alert: %s", err)
 	}
+	config.annotateChange(d, "librato_alert", "deleted", config.affixName(d.Get("name").(string)), nil)
 
 	return nil
 }
+
+// Lists every alert, optionally filtered by name, going through all pages.
+func libratoListAlerts(client *librato.Client, name string) ([]librato.Alert, error) {
+	var alerts []librato.Alert
+	opts := &librato.ListAlertsOptions{Name: name}
+	for {
+		page, resp, err := client.Alerts.List(opts)
+		if err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, page...)
+
+		if resp.NextPage == nil || len(page) == 0 {
+			return alerts, nil
+		}
+		next := opts.AdvancePage(resp.NextPage)
+		opts = &next
+	}
+}
+
+// Returns the IDs of the services an alert read from Librato notifies.
+func libratoAlertServiceIDs(alert librato.Alert) map[uint]struct{} {
+	ids := make(map[uint]struct{})
+	services, _ := alert.Services.([]interface{})
+	for _, s := range services {
+		if serviceData, ok := s.(map[string]interface{}); ok {
+			// ID field is returned as float64, for whatever reason
+			if id, ok := serviceData["id"].(float64); ok {
+				ids[uint(id)] = struct{}{}
+			}
+		}
+	}
+	return ids
+}
@@ -0,0 +1,66 @@
+package librato
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+func resourceLibratoAlertClear() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceLibratoAlertClearCreate,
+		Read:   schema.Noop,
+		Delete: schema.RemoveFromState,
+
+		Schema: map[string]*schema.Schema{
+			"alert_id": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			"triggers": {
+				Type:     schema.TypeMap,
+				Optional: true,
+				ForceNew: true,
+			},
+			"was_triggered": {
+				Type:     schema.TypeBool,
+				Computed: true,
+			},
+			"cleared_at": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+		},
+	}
+}
+
+func resourceLibratoAlertClearCreate(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*Config).Client
+
+	id, err := strconv.ParseUint(d.Get("alert_id").(string), 10, 0)
+	if err != nil {
+		return err
+	}
+
+	status, _, err := client.Alerts.Status(uint(id))
+	if err != nil {
+		return fmt.Errorf("Error reading Librato Alert status %d: %s", id, err)
+	}
+	wasTriggered := status.Status != nil && *status.Status == "triggered"
+	log.Printf("[INFO] Librato alert %d triggered before clearing: %t", id, wasTriggered)
+
+	if err := resourceLibratoAlertClearTriggered(client, uint(id)); err != nil {
+		return err
+	}
+
+	d.SetId(resource.UniqueId())
+	d.Set("was_triggered", wasTriggered)
+	d.Set("cleared_at", time.Now().UTC().Format(time.RFC3339))
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package librato
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/acctest"
+	"github.com/hashicorp/terraform/helper/resource"
+)
+
+func TestAccLibratoAlertClear_Basic(t *testing.T) {
+	name := acctest.RandString(10)
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckLibratoAlertDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccCheckLibratoAlertClearConfig_basic(name, 10),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr(
+						"librato_alert_clear.foobar", "was_triggered", "false"),
+					resource.TestCheckResourceAttrSet(
+						"librato_alert_clear.foobar", "cleared_at"),
+					resource.TestCheckResourceAttr(
+						"librato_alert_clear.foobar", "triggers.threshold", "10"),
+				),
+			},
+			{
+				Config: testAccCheckLibratoAlertClearConfig_basic(name, 20),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr(
+						"librato_alert.foobar", "clear_on_update", "true"),
+					resource.TestCheckResourceAttr(
+						"librato_alert_clear.foobar", "triggers.threshold", "20"),
+				),
+			},
+		},
+	})
+}
+
+func testAccCheckLibratoAlertClearConfig_basic(name string, threshold int) string {
+	return fmt.Sprintf(`
+resource "librato_alert" "foobar" {
+    name = "%s"
+    clear_on_update = true
+    condition {
+      type = "above"
+      threshold = %d
+      metric_name = "librato.cpu.percent.idle"
+    }
+}
+
+resource "librato_alert_clear" "foobar" {
+    alert_id = "${librato_alert.foobar.id}"
+    triggers {
+      threshold = "%d"
+    }
+}`, name, threshold, threshold)
+}
@@ -0,0 +1,247 @@
+package librato
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/henrikhodne/go-librato/librato"
+)
+
+func resourceLibratoAlertMaintenance() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceLibratoAlertMaintenanceCreate,
+		Read:   resourceLibratoAlertMaintenanceRead,
+		Update: resourceLibratoAlertMaintenanceUpdate,
+		Delete: resourceLibratoAlertMaintenanceDelete,
+
+		Schema: map[string]*schema.Schema{
+			"alert_ids": {
+				Type:     schema.TypeSet,
+				Required: true,
+				ForceNew: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+				Set:      schema.HashString,
+			},
+			"end_time": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				ForceNew:      true,
+				ConflictsWith: []string{"duration"},
+				ValidateFunc: func(v interface{}, k string) (ws []string, es []error) {
+					if _, err := time.Parse(time.RFC3339, v.(string)); err != nil {
+						es = append(es, fmt.Errorf("%q must be an RFC 3339 timestamp: %s", k, err))
+					}
+					return
+				},
+			},
+			"duration": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				ForceNew:      true,
+				ConflictsWith: []string{"end_time"},
+				ValidateFunc: func(v interface{}, k string) (ws []string, es []error) {
+					if _, err := time.ParseDuration(v.(string)); err != nil {
+						es = append(es, fmt.Errorf("%q must be a duration such as \"2h30m\": %s", k, err))
+					}
+					return
+				},
+			},
+			"expires_at": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"expired": {
+				Type:     schema.TypeBool,
+				Computed: true,
+			},
+			"prior_active": {
+				Type:     schema.TypeMap,
+				Computed: true,
+			},
+			// Set by refreshes once the window has ended. It is never
+			// configured, so the next plan updates the window to unset it,
+			// which restores the alerts.
+			"pending_restore": {
+				Type:     schema.TypeBool,
+				Optional: true,
+			},
+		},
+	}
+}
+
+// Returns the end of the maintenance window an alert is in, or the zero time
+// if it isn't in one.
+func libratoAlertMaintenanceUntil(alert *librato.Alert) time.Time {
+	if alert.Attributes == nil || alert.Attributes.MaintenanceUntil == nil {
+		return time.Time{}
+	}
+	return time.Unix(int64(*alert.Attributes.MaintenanceUntil), 0)
+}
+
+func resourceLibratoAlertMaintenanceCreate(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*Config).Client
+
+	var expiresAt time.Time
+	if v, ok := d.GetOk("end_time"); ok {
+		expiresAt, _ = time.Parse(time.RFC3339, v.(string))
+	} else if v, ok := d.GetOk("duration"); ok {
+		duration, _ := time.ParseDuration(v.(string))
+		expiresAt = time.Now().Add(duration)
+	} else {
+		return fmt.Errorf("One of end_time or duration must be set")
+	}
+	if !expiresAt.After(time.Now()) {
+		return fmt.Errorf("Maintenance window must end in the future, got %s", expiresAt.Format(time.RFC3339))
+	}
+
+	d.SetId(resource.UniqueId())
+	d.Set("expires_at", expiresAt.Format(time.RFC3339))
+	d.Set("expired", false)
+
+	priorActive := make(map[string]interface{})
+	for _, v := range d.Get("alert_ids").(*schema.Set).List() {
+		id, err := strconv.ParseUint(v.(string), 10, 0)
+		if err != nil {
+			return err
+		}
+
+		alert, _, err := client.Alerts.Get(uint(id))
+		if err != nil {
+			d.Set("prior_active", priorActive)
+			return fmt.Errorf("Error reading Librato Alert %d: %s", id, err)
+		}
+		active := alert.Active == nil || *alert.Active
+		if libratoAlertMaintenanceUntil(alert).After(time.Now()) {
+			log.Printf("[WARN] Librato Alert %d is already in a maintenance window, it will be restored as inactive", id)
+		}
+
+		until := uint(expiresAt.Unix())
+		if err := resourceLibratoAlertMaintenanceSetActive(client, alert, false, &until); err != nil {
+			d.Set("prior_active", priorActive)
+			return err
+		}
+		priorActive[v.(string)] = strconv.FormatBool(active)
+	}
+
+	if err := d.Set("prior_active", priorActive); err != nil {
+		return err
+	}
+
+	return resourceLibratoAlertMaintenanceRead(d, meta)
+}
+
+// Reads only report an expired window, as refreshes must not write to the
+// API. The alerts are restored by the update pending_restore leads to.
+func resourceLibratoAlertMaintenanceRead(d *schema.ResourceData, meta interface{}) error {
+	if d.Get("expired").(bool) {
+		return nil
+	}
+
+	expiresAt, err := time.Parse(time.RFC3339, d.Get("expires_at").(string))
+	if err != nil {
+		return err
+	}
+	if expiresAt.After(time.Now()) {
+		return nil
+	}
+
+	log.Printf("[INFO] Librato Alert maintenance %s expired at %s, its alerts are restored on the next apply", d.Id(), expiresAt)
+	d.Set("expired", true)
+	d.Set("pending_restore", true)
+
+	return nil
+}
+
+// Restores the alerts of an expired window. The window is kept in the state,
+// and does nothing from then on.
+func resourceLibratoAlertMaintenanceUpdate(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*Config).Client
+
+	// A failed restore keeps pending_restore, so the next apply retries it
+	d.Partial(true)
+	if d.HasChange("pending_restore") && d.Get("expired").(bool) {
+		log.Printf("[INFO] Restoring the alerts of expired Librato Alert maintenance %s", d.Id())
+		if err := resourceLibratoAlertMaintenanceRestore(d, client); err != nil {
+			return err
+		}
+	}
+	d.Partial(false)
+	d.Set("pending_restore", false)
+
+	return nil
+}
+
+func resourceLibratoAlertMaintenanceDelete(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*Config).Client
+
+	if err := resourceLibratoAlertMaintenanceRestore(d, client); err != nil {
+		return err
+	}
+
+	d.SetId("")
+	return nil
+}
+
+// Sets every alert of the window back to the active state it had before the
+// window was opened. Alerts no longer in the window, because they were
+// restored already or put in another window since, are left alone.
+func resourceLibratoAlertMaintenanceRestore(d *schema.ResourceData, client *librato.Client) error {
+	expiresAt, err := time.Parse(time.RFC3339, d.Get("expires_at").(string))
+	if err != nil {
+		return err
+	}
+
+	priorActive := d.Get("prior_active").(map[string]interface{})
+	for k, v := range priorActive {
+		id, err := strconv.ParseUint(k, 10, 0)
+		if err != nil {
+			return err
+		}
+
+		alert, _, err := client.Alerts.Get(uint(id))
+		if err != nil {
+			if librato.IsNotFound(err) {
+				log.Printf("[WARN] Librato Alert %d not found, nothing to restore", id)
+				continue
+			}
+			return fmt.Errorf("Error reading Librato Alert %d: %s", id, err)
+		}
+		if !libratoAlertMaintenanceUntil(alert).Equal(expiresAt) {
+			log.Printf("[INFO] Librato Alert %d is no longer in maintenance window %s, nothing to restore", id, d.Id())
+			continue
+		}
+
+		active, _ := strconv.ParseBool(v.(string))
+		if err := resourceLibratoAlertMaintenanceSetActive(client, alert, active, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func resourceLibratoAlertMaintenanceSetActive(client *librato.Client, alert *librato.Alert, active bool, until *uint) error {
+	attributes := new(librato.AlertAttributes)
+	if alert.Attributes != nil {
+		*attributes = *alert.Attributes
+	}
+	attributes.MaintenanceUntil = until
+
+	update := &librato.Alert{
+		Name:       alert.Name,
+		Conditions: alert.Conditions,
+		Active:     librato.Bool(active),
+		Attributes: attributes,
+	}
+
+	log.Printf("[INFO] Setting Librato alert %d active: %t", *alert.ID, active)
+	if _, err := client.Alerts.Update(*alert.ID, update); err != nil {
+		return fmt.Errorf("Error updating Librato alert %d: %s", *alert.ID, err)
+	}
+
+	return nil
+}
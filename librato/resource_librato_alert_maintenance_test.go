@@ -0,0 +1,207 @@
+package librato
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform/helper/acctest"
+	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/henrikhodne/go-librato/librato"
+)
+
+func TestAccLibratoAlertMaintenance_Basic(t *testing.T) {
+	var alert librato.Alert
+	name := acctest.RandString(10)
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckLibratoAlertDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccCheckLibratoAlertMaintenanceConfig_basic(name),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckLibratoAlertExists("librato_alert.foobar", &alert),
+					testAccCheckLibratoAlertActive(&alert, false),
+					resource.TestCheckResourceAttr(
+						"librato_alert.foobar", "active", "true"),
+					resource.TestCheckResourceAttr(
+						"librato_alert_maintenance.foobar", "expired", "false"),
+					resource.TestCheckResourceAttrSet(
+						"librato_alert_maintenance.foobar", "expires_at"),
+				),
+			},
+			{
+				Config: testAccCheckLibratoAlertConfig_basic(name),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckLibratoAlertExists("librato_alert.foobar", &alert),
+					testAccCheckLibratoAlertActive(&alert, true),
+				),
+			},
+		},
+	})
+}
+
+func TestResourceLibratoAlertMaintenance_expired(t *testing.T) {
+	api, server := newFakeLibratoAPI()
+	defer server.Close()
+	baseURL, _ := url.Parse(server.URL + "/v1/")
+	meta := &Config{Client: librato.NewClientWithBaseURL(baseURL, "user", "token")}
+
+	alert, _, err := meta.Client.Alerts.Create(&librato.Alert{Name: librato.String("foo.bar")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	alertID := strconv.FormatUint(uint64(*alert.ID), 10)
+	active := func() bool {
+		api.mu.Lock()
+		defer api.mu.Unlock()
+		return api.objects["alerts/"+alertID]["active"].(bool)
+	}
+
+	r := resourceLibratoAlertMaintenance()
+	d := schema.TestResourceDataRaw(t, r.Schema, map[string]interface{}{
+		"alert_ids": []interface{}{alertID},
+		"duration":  "1h",
+	})
+	if err := r.Create(d, meta); err != nil {
+		t.Fatal(err)
+	}
+	if active() {
+		t.Fatalf("Expected the alert to be deactivated")
+	}
+
+	// Refreshing an expired window leaves the alert alone
+	expiresAt := time.Now().Add(-time.Minute)
+	d.Set("expires_at", expiresAt.Format(time.RFC3339))
+	api.mu.Lock()
+	api.objects["alerts/"+alertID]["attributes"] = map[string]interface{}{"maintenance_until": expiresAt.Unix()}
+	api.mu.Unlock()
+	if err := r.Read(d, meta); err != nil {
+		t.Fatal(err)
+	}
+	if active() {
+		t.Fatalf("Expected the alert to be left deactivated by the refresh")
+	}
+	if !d.Get("expired").(bool) || !d.Get("pending_restore").(bool) || d.Get("duration").(string) != "1h" {
+		t.Fatalf("Expected the window to be marked expired and pending a restore")
+	}
+
+	if err := r.Delete(d, meta); err != nil {
+		t.Fatal(err)
+	}
+	if !active() {
+		t.Fatalf("Expected the alert to be restored on destroy")
+	}
+}
+
+// Applying after a window has ended restores its alerts once, and the window
+// is kept as it is from then on.
+func TestLibratoAlertMaintenance_restoreOnExpiry(t *testing.T) {
+	api, server := newFakeLibratoAPI()
+	defer server.Close()
+
+	alertActive := func(active bool) resource.TestCheckFunc {
+		return func(s *terraform.State) error {
+			api.mu.Lock()
+			defer api.mu.Unlock()
+			for k, object := range api.objects {
+				if object["active"] != active {
+					return fmt.Errorf("Bad active of %s: %v", k, object["active"])
+				}
+			}
+			return nil
+		}
+	}
+	puts := 0
+	alertUpdates := func(expected int) resource.TestCheckFunc {
+		return func(s *terraform.State) error {
+			api.mu.Lock()
+			defer api.mu.Unlock()
+			n := 0
+			for _, r := range api.requests {
+				if strings.HasPrefix(r, "PUT alerts/") {
+					n++
+				}
+			}
+			if n-puts != expected {
+				return fmt.Errorf("Expected %d alert updates, got %d", expected, n-puts)
+			}
+			puts = n
+			return nil
+		}
+	}
+
+	config := testFakeLibratoProviderConfig + `
+resource "librato_alert" "foobar" {
+    name = "foo.bar"
+}
+
+resource "librato_alert_maintenance" "foobar" {
+    alert_ids = [ "${librato_alert.foobar.id}" ]
+    duration = "3s"
+}`
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers: testFakeLibratoProviders(server),
+		Steps: []resource.TestStep{
+			{
+				Config: config,
+				Check: resource.ComposeTestCheckFunc(
+					alertActive(false),
+					alertUpdates(1),
+				),
+			},
+			{
+				PreConfig: func() { time.Sleep(4 * time.Second) },
+				Config:    config,
+				Check: resource.ComposeTestCheckFunc(
+					alertActive(true),
+					// The restore, and the librato_alert no longer in a
+					// window reporting the alert inactive
+					alertUpdates(2),
+					resource.TestCheckResourceAttr(
+						"librato_alert_maintenance.foobar", "expired", "true"),
+					resource.TestCheckResourceAttr(
+						"librato_alert_maintenance.foobar", "pending_restore", "false"),
+				),
+			},
+			{
+				Config: config,
+				Check: resource.ComposeTestCheckFunc(
+					alertActive(true),
+					alertUpdates(0),
+				),
+			},
+		},
+	})
+}
+
+func testAccCheckLibratoAlertActive(alert *librato.Alert, active bool) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		if alert.Active == nil || *alert.Active != active {
+			return fmt.Errorf("Bad active: %v", alert.Active)
+		}
+
+		return nil
+	}
+}
+
+func testAccCheckLibratoAlertMaintenanceConfig_basic(name string) string {
+	return fmt.Sprintf(`
+resource "librato_alert" "foobar" {
+    name = "%s"
+    description = "A Test Alert"
+}
+
+resource "librato_alert_maintenance" "foobar" {
+    alert_ids = [ "${librato_alert.foobar.id}" ]
+    duration = "1h"
+}`, name)
+}
@@ -0,0 +1,520 @@
+package librato
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/henrikhodne/go-librato/librato"
+)
+
+// Fields that make up the alert template. A change to any of them means every
+// alert in the set has to be updated.
+var libratoAlertSetTemplateKeys = []string{
+	"name",
+	"placeholder",
+	"description",
+	"active",
+	"rearm_seconds",
+	"services",
+	"condition",
+	"attributes",
+}
+
+func resourceLibratoAlertSet() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceLibratoAlertSetCreate,
+		Read:   resourceLibratoAlertSetRead,
+		Update: resourceLibratoAlertSetUpdate,
+		Delete: resourceLibratoAlertSetDelete,
+
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+			"placeholder": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Default:  "{{value}}",
+				ValidateFunc: func(v interface{}, k string) (ws []string, es []error) {
+					if v.(string) == "" {
+						es = append(es, fmt.Errorf("%q must not be empty", k))
+					}
+					return
+				},
+			},
+			"values": {
+				Type:     schema.TypeSet,
+				Required: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+				Set:      schema.HashString,
+			},
+			"description": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"active": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  true,
+			},
+			"rearm_seconds": {
+				Type:     schema.TypeInt,
+				Optional: true,
+				Default:  600,
+			},
+			"services": {
+				Type:     schema.TypeSet,
+				Optional: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+				Set:      schema.HashString,
+			},
+			"condition": {
+				Type:     schema.TypeSet,
+				Optional: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"type": {
+							Type:     schema.TypeString,
+							Required: true,
+						},
+						"metric_name": {
+							Type:     schema.TypeString,
+							Required: true,
+						},
+						"source": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+						"tag": libratoTagSchema(false),
+						"detect_reset": {
+							Type:     schema.TypeBool,
+							Optional: true,
+						},
+						"duration": {
+							Type:     schema.TypeInt,
+							Optional: true,
+						},
+						"threshold": {
+							Type:     schema.TypeFloat,
+							Optional: true,
+						},
+						"summary_function": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+					},
+				},
+				Set: resourceLibratoAlertConditionsHash,
+			},
+			"attributes": {
+				Type:     schema.TypeList,
+				Optional: true,
+				MaxItems: 1,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"runbook_url": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+					},
+				},
+			},
+			// The values whose alert was changed outside of Terraform. Refreshes
+			// set it, and as it's never configured the next plan updates the
+			// set to unset it, which updates those alerts back to the template.
+			"drifted_values": {
+				Type:     schema.TypeSet,
+				Optional: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+				Set:      schema.HashString,
+			},
+			"alert_ids": {
+				Type:     schema.TypeMap,
+				Computed: true,
+			},
+		},
+	}
+}
+
+// Renders the alert template for a single value of the set, replacing the
+// placeholder in the name, description, runbook URL and condition sources and
+// tag values. The provider's name affixes are added like for alerts.
+func resourceLibratoAlertSetExpand(config *Config, d *schema.ResourceData, value string) *librato.Alert {
+	placeholder := d.Get("placeholder").(string)
+	render := func(s string) string {
+		return strings.Replace(s, placeholder, value, -1)
+	}
+
+	alert := &librato.Alert{
+		Name: librato.String(config.affixName(render(d.Get("name").(string)))),
+	}
+	if v, ok := d.GetOk("description"); ok {
+		alert.Description = librato.String(render(v.(string)))
+	}
+	// GetOK returns not OK for false boolean values, use Get
+	alert.Active = librato.Bool(d.Get("active").(bool))
+	if v, ok := d.GetOk("rearm_seconds"); ok {
+		alert.RearmSeconds = librato.Uint(uint(v.(int)))
+	}
+	if v, ok := d.GetOk("services"); ok {
+		vs := v.(*schema.Set)
+		services := make([]*string, vs.Len())
+		for i, serviceData := range vs.List() {
+			services[i] = librato.String(serviceData.(string))
+		}
+		alert.Services = services
+	}
+	if v, ok := d.GetOk("condition"); ok {
+		vs := v.(*schema.Set)
+		conditions := make([]librato.AlertCondition, vs.Len())
+		for i, conditionDataM := range vs.List() {
+			conditionData := conditionDataM.(map[string]interface{})
+			condition := resourceLibratoAlertConditionExpand(conditionData)
+			if condition.MetricName != nil {
+				condition.MetricName = librato.String(config.affixMetricName(*condition.MetricName))
+			}
+			if condition.Source != nil {
+				condition.Source = librato.String(render(*condition.Source))
+			}
+			for _, tag := range condition.Tags {
+				for j, tv := range tag.Values {
+					tag.Values[j] = librato.String(render(*tv))
+				}
+			}
+			conditions[i] = condition
+		}
+		alert.Conditions = conditions
+	}
+	if v, ok := d.GetOk("attributes"); ok {
+		attributeData := v.([]interface{})
+		if len(attributeData) == 1 && attributeData[0] != nil {
+			attributeDataMap := attributeData[0].(map[string]interface{})
+			attributes := new(librato.AlertAttributes)
+			if v, ok := attributeDataMap["runbook_url"].(string); ok && v != "" {
+				attributes.RunbookURL = librato.String(render(v))
+			}
+			alert.Attributes = attributes
+		}
+	}
+
+	return alert
+}
+
+func resourceLibratoAlertSetCreate(d *schema.ResourceData, meta interface{}) error {
+	config := meta.(*Config)
+	client := config.Client
+
+	if err := resourceLibratoAlertSetCheckName(d); err != nil {
+		return err
+	}
+	if err := config.checkBackend("librato_alert_set", d); err != nil {
+		return err
+	}
+	if err := resourceLibratoAlertSetCheckPolicy(config, d); err != nil {
+		return err
+	}
+
+	d.SetId(resource.UniqueId())
+
+	alertIDs := make(map[string]interface{})
+	for _, v := range d.Get("values").(*schema.Set).List() {
+		value := v.(string)
+		id, err := resourceLibratoAlertSetCreateAlert(client, resourceLibratoAlertSetExpand(config, d, value))
+		if err != nil {
+			d.Set("alert_ids", alertIDs)
+			return err
+		}
+		alertIDs[value] = strconv.FormatUint(uint64(id), 10)
+	}
+
+	if err := d.Set("alert_ids", alertIDs); err != nil {
+		return err
+	}
+
+	return resourceLibratoAlertSetRead(d, meta)
+}
+
+// Without the placeholder in the name, the alerts of all values would be
+// created with the same name.
+func resourceLibratoAlertSetCheckName(d *schema.ResourceData) error {
+	name, placeholder := d.Get("name").(string), d.Get("placeholder").(string)
+	if !strings.Contains(name, placeholder) {
+		return fmt.Errorf("name %q must contain the placeholder %q", name, placeholder)
+	}
+	return nil
+}
+
+// Checks the alert of every value against the librato_alert policy rules,
+// before any of them is changed.
+func resourceLibratoAlertSetCheckPolicy(config *Config, d *schema.ResourceData) error {
+	for _, v := range d.Get("values").(*schema.Set).List() {
+		if err := config.checkAlertPolicy(resourceLibratoAlertSetExpand(config, d, v.(string))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func resourceLibratoAlertSetCreateAlert(client *librato.Client, alert *librato.Alert) (uint, error) {
+	alertResult, _, err := client.Alerts.Create(alert)
+	if err != nil {
+		return 0, fmt.Errorf("Error creating Librato alert %s: %s", *alert.Name, err)
+	}
+	log.Printf("[INFO] Created Librato alert: %s", *alertResult)
+
+	retryErr := resource.Retry(1*time.Minute, func() *resource.RetryError {
+		_, _, err := client.Alerts.Get(*alertResult.ID)
+		if err != nil {
+			if librato.IsNotFound(err) {
+				return resource.RetryableError(err)
+			}
+			return resource.NonRetryableError(err)
+		}
+		return nil
+	})
+	if retryErr != nil {
+		return 0, fmt.Errorf("Error creating Librato alert %s: %s", *alert.Name, retryErr)
+	}
+
+	return *alertResult.ID, nil
+}
+
+// The values are those with an alert, so that the next plan creates the
+// alerts of values missing one, e.g. after a failed create or a deletion
+// outside of Terraform.
+func resourceLibratoAlertSetRead(d *schema.ResourceData, meta interface{}) error {
+	config := meta.(*Config)
+	client := config.Client
+
+	values := schema.NewSet(schema.HashString, nil)
+	drifted := schema.NewSet(schema.HashString, nil)
+	alertIDs := make(map[string]interface{})
+	for value, v := range d.Get("alert_ids").(map[string]interface{}) {
+		id, err := strconv.ParseUint(v.(string), 10, 0)
+		if err != nil {
+			return err
+		}
+
+		log.Printf("[INFO] Reading Librato Alert %d for value %q", id, value)
+		alert, _, err := client.Alerts.Get(uint(id))
+		if err != nil {
+			if librato.IsNotFound(err) {
+				log.Printf("[WARN] Librato Alert %d for value %q not found", id, value)
+				continue
+			}
+			return fmt.Errorf("Error reading Librato Alert %d: %s", id, err)
+		}
+		values.Add(value)
+		alertIDs[value] = v
+
+		if drift := resourceLibratoAlertSetDrift(config, resourceLibratoAlertSetExpand(config, d, value), alert); len(drift) > 0 {
+			log.Printf("[WARN] Librato Alert %d for value %q differs from the template in %s", id, value, strings.Join(drift, ", "))
+			drifted.Add(value)
+		}
+	}
+
+	if len(alertIDs) == 0 {
+		d.SetId("")
+		return nil
+	}
+
+	if err := d.Set("values", values); err != nil {
+		return err
+	}
+	if err := d.Set("drifted_values", drifted); err != nil {
+		return err
+	}
+	if err := d.Set("alert_ids", alertIDs); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Returns the attributes an alert of the set differs in from its rendered
+// template. They're compared as librato_alert compares an alert to its
+// configuration, so that defaults filled in by the API aren't drift.
+func resourceLibratoAlertSetDrift(config *Config, want, got *librato.Alert) []string {
+	var drift []string
+
+	if stringValue(got.Name) != stringValue(want.Name) {
+		drift = append(drift, "name")
+	}
+	if stringValue(got.Description) != stringValue(want.Description) {
+		drift = append(drift, "description")
+	}
+	// Alerts deactivated by an open librato_alert_maintenance window keep
+	// their configured state
+	if got.Active != nil && !libratoAlertMaintenanceUntil(got).After(time.Now()) && *got.Active != *want.Active {
+		drift = append(drift, "active")
+	}
+	if got.RearmSeconds != nil && want.RearmSeconds != nil && *got.RearmSeconds != *want.RearmSeconds {
+		drift = append(drift, "rearm_seconds")
+	}
+
+	wantServices := schema.NewSet(schema.HashString, nil)
+	if services, ok := want.Services.([]*string); ok {
+		wantServices = schema.NewSet(schema.HashString, libratoStringsFlatten(services))
+	}
+	gotServices := schema.NewSet(schema.HashString, nil)
+	if services, ok := got.Services.([]interface{}); ok {
+		gotServices = schema.NewSet(schema.HashString, resourceLibratoAlertServicesGather(nil, services))
+	}
+	if !gotServices.Equal(wantServices) {
+		drift = append(drift, "services")
+	}
+
+	wantConditions := schema.NewSet(resourceLibratoAlertConditionsHash, resourceLibratoAlertConditionsGather(nil, config, want.Conditions))
+	gotConditions := schema.NewSet(resourceLibratoAlertConditionsHash, resourceLibratoAlertConditionsGather(nil, config, got.Conditions))
+	// Sets compare their elements on Equal, but the API fills in defaults the
+	// hash leaves out
+	if gotConditions.Difference(wantConditions).Len() > 0 || wantConditions.Difference(gotConditions).Len() > 0 {
+		drift = append(drift, "condition")
+	}
+
+	if !reflect.DeepEqual(resourceLibratoAlertAttributesGather(nil, got.Attributes), resourceLibratoAlertAttributesGather(nil, want.Attributes)) {
+		drift = append(drift, "attributes")
+	}
+
+	return drift
+}
+
+func resourceLibratoAlertSetUpdate(d *schema.ResourceData, meta interface{}) error {
+	config := meta.(*Config)
+	client := config.Client
+
+	if err := resourceLibratoAlertSetCheckName(d); err != nil {
+		return err
+	}
+	if err := config.checkBackend("librato_alert_set", d); err != nil {
+		return err
+	}
+	if err := resourceLibratoAlertSetCheckPolicy(config, d); err != nil {
+		return err
+	}
+
+	alertIDs := make(map[string]interface{})
+	for value, id := range d.Get("alert_ids").(map[string]interface{}) {
+		alertIDs[value] = id
+	}
+
+	o, n := d.GetChange("values")
+	oldValues, newValues := o.(*schema.Set), n.(*schema.Set)
+
+	for _, v := range oldValues.Difference(newValues).List() {
+		value := v.(string)
+		if id, ok := alertIDs[value]; ok {
+			if err := resourceLibratoAlertSetDeleteAlert(client, id.(string)); err != nil {
+				d.Set("alert_ids", alertIDs)
+				return err
+			}
+			delete(alertIDs, value)
+		}
+	}
+
+	templateChanged := false
+	for _, k := range libratoAlertSetTemplateKeys {
+		if d.HasChange(k) {
+			templateChanged = true
+			break
+		}
+	}
+
+	// Without a change to the template, only the alerts changed outside of
+	// Terraform are updated
+	updateValues := oldValues.Intersection(newValues)
+	if !templateChanged {
+		o, _ := d.GetChange("drifted_values")
+		updateValues = updateValues.Intersection(o.(*schema.Set))
+	}
+
+	for _, v := range updateValues.List() {
+		value := v.(string)
+		id, ok := alertIDs[value]
+		if !ok {
+			continue
+		}
+		alertID, err := strconv.ParseUint(id.(string), 10, 0)
+		if err != nil {
+			return err
+		}
+
+		alert := resourceLibratoAlertSetExpand(config, d, value)
+		log.Printf("[INFO] Updating Librato alert %d: %s", alertID, alert)
+		if _, err := client.Alerts.Update(uint(alertID), alert); err != nil {
+			d.Set("alert_ids", alertIDs)
+			return fmt.Errorf("Error updating Librato alert %s: %s", *alert.Name, libratoAttributeError(d, resourceLibratoAlertSet().Schema, err))
+		}
+	}
+
+	for _, v := range newValues.Difference(oldValues).List() {
+		value := v.(string)
+		id, err := resourceLibratoAlertSetCreateAlert(client, resourceLibratoAlertSetExpand(config, d, value))
+		if err != nil {
+			d.Set("alert_ids", alertIDs)
+			return err
+		}
+		alertIDs[value] = strconv.FormatUint(uint64(id), 10)
+	}
+
+	if err := d.Set("alert_ids", alertIDs); err != nil {
+		return err
+	}
+
+	return resourceLibratoAlertSetRead(d, meta)
+}
+
+func resourceLibratoAlertSetDelete(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*Config).Client
+
+	alertIDs := d.Get("alert_ids").(map[string]interface{})
+	for value, id := range alertIDs {
+		if err := resourceLibratoAlertSetDeleteAlert(client, id.(string)); err != nil {
+			d.Set("alert_ids", alertIDs)
+			return err
+		}
+		delete(alertIDs, value)
+	}
+
+	d.SetId("")
+	return nil
+}
+
+func resourceLibratoAlertSetDeleteAlert(client *librato.Client, alertID string) error {
+	id, err := strconv.ParseUint(alertID, 10, 0)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[INFO] Deleting Alert: %d", id)
+	_, err = client.Alerts.Delete(uint(id))
+	if err != nil {
+		if librato.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("Error deleting Alert %d: %s", id, err)
+	}
+
+	retryErr := resource.Retry(1*time.Minute, func() *resource.RetryError {
+		_, _, err := client.Alerts.Get(uint(id))
+		if err != nil {
+			if librato.IsNotFound(err) {
+				return nil
+			}
+			return resource.NonRetryableError(err)
+		}
+		return resource.RetryableError(fmt.Errorf("alert still exists"))
+	})
+	if retryErr != nil {
+		return fmt.Errorf("Error deleting librato alert %d: %s", id, retryErr)
+	}
+
+	return nil
+}
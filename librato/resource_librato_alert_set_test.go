@@ -0,0 +1,303 @@
+package librato
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/acctest"
+	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/henrikhodne/go-librato/librato"
+)
+
+func TestAccLibratoAlertSet_Basic(t *testing.T) {
+	var alert librato.Alert
+	name := acctest.RandString(10)
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckLibratoAlertSetDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccCheckLibratoAlertSetConfig_basic(name, `"queue-a", "queue-b"`),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckLibratoAlertSetMember("librato_alert_set.foobar", "queue-a", &alert),
+					testAccCheckLibratoAlertName(&alert, fmt.Sprintf("%s.queue-a", name)),
+					testAccCheckLibratoAlertDescription(&alert, "Backlog in queue-a"),
+					testAccCheckLibratoAlertSetMember("librato_alert_set.foobar", "queue-b", &alert),
+					testAccCheckLibratoAlertName(&alert, fmt.Sprintf("%s.queue-b", name)),
+					resource.TestCheckResourceAttr(
+						"librato_alert_set.foobar", "values.#", "2"),
+					resource.TestCheckResourceAttr(
+						"librato_alert_set.foobar", "alert_ids.%", "2"),
+				),
+			},
+		},
+	})
+}
+
+func TestLibratoAlertSet_nameAffixes(t *testing.T) {
+	api, server := newFakeLibratoAPI()
+	defer server.Close()
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers:    testFakeLibratoProviders(server),
+		CheckDestroy: testCheckFakeLibratoAPIEmpty(api),
+		Steps: []resource.TestStep{
+			{
+				Config: testLibratoAlertSetConfig_nameAffixes,
+				Check: resource.ComposeTestCheckFunc(
+					testCheckFakeLibratoAPINames(api, "alerts", "queue.a-dev", "queue.b-dev"),
+					func(s *terraform.State) error {
+						api.mu.Lock()
+						defer api.mu.Unlock()
+						for k, object := range api.objects {
+							condition := object["conditions"].([]interface{})[0].(map[string]interface{})
+							if condition["metric_name"] != "queue.depth-dev" {
+								return fmt.Errorf("Bad condition metric of %s: %v", k, condition["metric_name"])
+							}
+						}
+						return nil
+					},
+				),
+			},
+		},
+	})
+}
+
+const testLibratoAlertSetConfig_nameAffixes = `
+provider "librato" {
+    email = "test@example.com"
+    token = "test"
+    name_suffix = "-dev"
+    affix_metric_names = true
+}
+
+resource "librato_alert_set" "foobar" {
+    name = "queue.{{value}}"
+    values = [ "a", "b" ]
+    condition {
+      type = "above"
+      threshold = 1000
+      metric_name = "queue.depth"
+      source = "{{value}}"
+    }
+}`
+
+// Refreshing finds alerts changed or deleted outside of Terraform, and the next
+// apply updates or recreates only those.
+func TestLibratoAlertSet_drift(t *testing.T) {
+	api, server := newFakeLibratoAPI()
+	defer server.Close()
+
+	alert := func(name string) map[string]interface{} {
+		for _, object := range api.objects {
+			if object["name"] == name {
+				return object
+			}
+		}
+		return nil
+	}
+	counts := make(map[string]int)
+	requests := func(prefix string, expected int) resource.TestCheckFunc {
+		return func(s *terraform.State) error {
+			api.mu.Lock()
+			defer api.mu.Unlock()
+			n := 0
+			for _, r := range api.requests {
+				if strings.HasPrefix(r, prefix) {
+					n++
+				}
+			}
+			if n-counts[prefix] != expected {
+				return fmt.Errorf("Expected %d %q requests, got %d", expected, prefix, n-counts[prefix])
+			}
+			counts[prefix] = n
+			return nil
+		}
+	}
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers:    testFakeLibratoProviders(server),
+		CheckDestroy: testCheckFakeLibratoAPIEmpty(api),
+		Steps: []resource.TestStep{
+			{
+				Config: testFakeLibratoProviderConfig + testLibratoAlertSetConfig_drift("queue.{{value}}"),
+				Check: resource.ComposeTestCheckFunc(
+					testCheckFakeLibratoAPINames(api, "alerts", "queue.a", "queue.b"),
+					requests("POST alerts", 2),
+					requests("PUT alerts/", 0),
+				),
+			},
+			{
+				PreConfig: func() {
+					api.mu.Lock()
+					defer api.mu.Unlock()
+					alert("queue.a")["description"] = "Edited in the UI"
+					for k, object := range api.objects {
+						if object["name"] == "queue.b" {
+							delete(api.objects, k)
+						}
+					}
+				},
+				Config: testFakeLibratoProviderConfig + testLibratoAlertSetConfig_drift("queue.{{value}}"),
+				Check: resource.ComposeTestCheckFunc(
+					testCheckFakeLibratoAPINames(api, "alerts", "queue.a", "queue.b"),
+					requests("POST alerts", 1),
+					requests("PUT alerts/", 1),
+					func(s *terraform.State) error {
+						api.mu.Lock()
+						defer api.mu.Unlock()
+						if description := alert("queue.a")["description"]; description != "Backlog in a" {
+							return fmt.Errorf("Expected the description to be restored, got %v", description)
+						}
+						return nil
+					},
+					resource.TestCheckResourceAttr("librato_alert_set.foobar", "drifted_values.#", "0"),
+				),
+			},
+			{
+				Config:      testFakeLibratoProviderConfig + testLibratoAlertSetConfig_drift("queue.backlog"),
+				ExpectError: regexp.MustCompile(`must contain the placeholder "{{value}}"`),
+			},
+		},
+	})
+}
+
+func testLibratoAlertSetConfig_drift(name string) string {
+	return fmt.Sprintf(`
+resource "librato_alert_set" "foobar" {
+    name = "%s"
+    description = "Backlog in {{value}}"
+    values = [ "a", "b" ]
+    condition {
+      type = "above"
+      threshold = 1000
+      metric_name = "queue.depth"
+      source = "{{value}}"
+    }
+}`, name)
+}
+
+func TestAccLibratoAlertSet_AddRemoveValue(t *testing.T) {
+	var before, after librato.Alert
+	name := acctest.RandString(10)
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckLibratoAlertSetDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccCheckLibratoAlertSetConfig_basic(name, `"queue-a", "queue-b"`),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckLibratoAlertSetMember("librato_alert_set.foobar", "queue-a", &before),
+				),
+			},
+			{
+				Config: testAccCheckLibratoAlertSetConfig_basic(name, `"queue-a", "queue-c"`),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckLibratoAlertSetMember("librato_alert_set.foobar", "queue-a", &after),
+					testAccCheckLibratoAlertSetUnchanged(&before, &after),
+					testAccCheckLibratoAlertSetMember("librato_alert_set.foobar", "queue-c", &after),
+					testAccCheckLibratoAlertName(&after, fmt.Sprintf("%s.queue-c", name)),
+					resource.TestCheckNoResourceAttr(
+						"librato_alert_set.foobar", "alert_ids.queue-b"),
+				),
+			},
+		},
+	})
+}
+
+func testAccCheckLibratoAlertSetDestroy(s *terraform.State) error {
+	client := testAccProvider.Meta().(*Config).Client
+
+	for _, rs := range s.RootModule().Resources {
+		if rs.Type != "librato_alert_set" {
+			continue
+		}
+
+		for k, v := range rs.Primary.Attributes {
+			if !strings.HasPrefix(k, "alert_ids.") || k == "alert_ids.%" {
+				continue
+			}
+
+			id, err := strconv.ParseUint(v, 10, 0)
+			if err != nil {
+				return fmt.Errorf("ID not a number")
+			}
+
+			if _, _, err := client.Alerts.Get(uint(id)); err == nil {
+				return fmt.Errorf("Alert still exists")
+			}
+		}
+	}
+
+	return nil
+}
+
+func testAccCheckLibratoAlertSetMember(n, value string, alert *librato.Alert) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		rs, ok := s.RootModule().Resources[n]
+
+		if !ok {
+			return fmt.Errorf("Not found: %s", n)
+		}
+
+		rawID, ok := rs.Primary.Attributes[fmt.Sprintf("alert_ids.%s", value)]
+		if !ok {
+			return fmt.Errorf("No Alert ID is set for %s", value)
+		}
+
+		client := testAccProvider.Meta().(*Config).Client
+
+		id, err := strconv.ParseUint(rawID, 10, 0)
+		if err != nil {
+			return fmt.Errorf("ID not a number")
+		}
+
+		foundAlert, _, err := client.Alerts.Get(uint(id))
+
+		if err != nil {
+			return err
+		}
+
+		if foundAlert.ID == nil || *foundAlert.ID != uint(id) {
+			return fmt.Errorf("Alert not found")
+		}
+
+		*alert = *foundAlert
+
+		return nil
+	}
+}
+
+func testAccCheckLibratoAlertSetUnchanged(before, after *librato.Alert) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		if *before.ID != *after.ID {
+			return fmt.Errorf("Alert was recreated: %d != %d", *before.ID, *after.ID)
+		}
+
+		return nil
+	}
+}
+
+func testAccCheckLibratoAlertSetConfig_basic(name, values string) string {
+	return fmt.Sprintf(`
+resource "librato_alert_set" "foobar" {
+    name = "%s.{{value}}"
+    description = "Backlog in {{value}}"
+    values = [ %s ]
+    condition {
+      type = "above"
+      threshold = 1000
+      duration = 600
+      metric_name = "queue.depth"
+      source = "{{value}}"
+    }
+}`, name, values)
+}
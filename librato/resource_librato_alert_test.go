@@ -3,6 +3,7 @@ package librato
 import (
 	"fmt"
 	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/hashicorp/terraform/helper/acctest"
@@ -33,6 +34,57 @@ func TestAccLibratoAlert_Minimal(t *testing.T) {
 	})
 }
 
+func TestLibratoAlert_stateOnlyUpdate(t *testing.T) {
+	api, server := newFakeLibratoAPI()
+	defer server.Close()
+
+	updates := func() int {
+		api.mu.Lock()
+		defer api.mu.Unlock()
+		n := 0
+		for _, r := range api.requests {
+			if strings.HasPrefix(r, "PUT alerts/") {
+				n++
+			}
+		}
+		return n
+	}
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers:    testFakeLibratoProviders(server),
+		CheckDestroy: testCheckFakeLibratoAPIEmpty(api),
+		Steps: []resource.TestStep{
+			{
+				Config: testFakeLibratoProviderConfig + testLibratoAlertConfig_stateOnly("true", "false"),
+			},
+			{
+				Config: testFakeLibratoProviderConfig + testLibratoAlertConfig_stateOnly("false", "true"),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr(
+						"librato_alert.foobar", "deletion_protection", "false"),
+					resource.TestCheckResourceAttr(
+						"librato_alert.foobar", "clear_on_update", "true"),
+					func(s *terraform.State) error {
+						if n := updates(); n != 0 {
+							return fmt.Errorf("Expected no alert updates, got %d", n)
+						}
+						return nil
+					},
+				),
+			},
+		},
+	})
+}
+
+func testLibratoAlertConfig_stateOnly(deletionProtection, clearOnUpdate string) string {
+	return fmt.Sprintf(`
+resource "librato_alert" "foobar" {
+    name = "foo.bar"
+    deletion_protection = %s
+    clear_on_update = %s
+}`, deletionProtection, clearOnUpdate)
+}
+
 func TestAccLibratoAlert_Basic(t *testing.T) {
 	var alert librato.Alert
 	name := acctest.RandString(10)
@@ -182,7 +234,7 @@ func TestAccLibratoAlert_FullUpdate(t *testing.T) {
 }
 
 func testAccCheckLibratoAlertDestroy(s *terraform.State) error {
-	client := testAccProvider.Meta().(*librato.Client)
+	client := testAccProvider.Meta().(*Config).Client
 
 	for _, rs := range s.RootModule().Resources {
 		if rs.Type != "librato_alert" {
@@ -238,7 +290,7 @@ func testAccCheckLibratoAlertExists(n string, alert *librato.Alert) resource.Tes
 			return fmt.Errorf("No Alert ID is set")
 		}
 
-		client := testAccProvider.Meta().(*librato.Client)
+		client := testAccProvider.Meta().(*Config).Client
 
 		id, err := strconv.ParseUint(rs.Primary.ID, 10, 0)
 		if err != nil {
@@ -0,0 +1,104 @@
+package librato
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/henrikhodne/go-librato/librato"
+)
+
+// Unlike the data source, which requests a new snapshot on every read, the
+// resource requests one when it is created and only reads it back after that.
+func resourceLibratoChartSnapshot() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceLibratoChartSnapshotCreate,
+		Read:   resourceLibratoChartSnapshotRead,
+		Delete: resourceLibratoChartSnapshotDelete,
+
+		Schema: map[string]*schema.Schema{
+			"space_id": {
+				Type:     schema.TypeInt,
+				Required: true,
+				ForceNew: true,
+			},
+			"chart_id": {
+				Type:     schema.TypeInt,
+				Required: true,
+				ForceNew: true,
+			},
+			"duration": {
+				Type:     schema.TypeInt,
+				Optional: true,
+				Default:  3600,
+				ForceNew: true,
+			},
+			"end_time": {
+				Type:     schema.TypeInt,
+				Optional: true,
+				ForceNew: true,
+			},
+			"source": {
+				Type:     schema.TypeString,
+				Optional: true,
+				ForceNew: true,
+			},
+			"href": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"image_href": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+		},
+	}
+}
+
+func resourceLibratoChartSnapshotCreate(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*Config).Client
+
+	snapshot, id, err := libratoChartSnapshotRequest(client, d)
+	if err != nil {
+		return err
+	}
+	log.Printf("[INFO] Created Librato snapshot: %s", *snapshot)
+
+	d.SetId(strconv.FormatUint(uint64(id), 10))
+	d.Set("href", stringValue(snapshot.Href))
+	d.Set("image_href", *snapshot.ImageHref)
+
+	return nil
+}
+
+func resourceLibratoChartSnapshotRead(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*Config).Client
+	id, err := strconv.ParseUint(d.Id(), 10, 0)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[INFO] Reading Librato Snapshot: %d", id)
+	snapshot, _, err := client.Snapshots.Get(uint(id))
+	if err != nil {
+		if librato.IsNotFound(err) {
+			d.SetId("")
+			return nil
+		}
+		return fmt.Errorf("Error reading Librato Snapshot %s: %s", d.Id(), err)
+	}
+
+	d.Set("href", stringValue(snapshot.Href))
+	d.Set("image_href", stringValue(snapshot.ImageHref))
+
+	return nil
+}
+
+// Snapshots can't be deleted through the API, destroying one only removes it
+// from the state.
+func resourceLibratoChartSnapshotDelete(d *schema.ResourceData, meta interface{}) error {
+	log.Printf("[INFO] Librato Snapshot %s can't be deleted, removing it from the state", d.Id())
+	d.SetId("")
+	return nil
+}
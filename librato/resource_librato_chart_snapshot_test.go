@@ -0,0 +1,80 @@
+package librato
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func TestLibratoChartSnapshot_requestedOnce(t *testing.T) {
+	api, server := newFakeLibratoAPI()
+	defer server.Close()
+
+	snapshots := func(expected int) resource.TestCheckFunc {
+		return func(s *terraform.State) error {
+			api.mu.Lock()
+			defer api.mu.Unlock()
+			n := 0
+			for _, r := range api.requests {
+				if r == "POST snapshots" {
+					n++
+				}
+			}
+			if n != expected {
+				return fmt.Errorf("Expected %d snapshot requests, got %d", expected, n)
+			}
+			return nil
+		}
+	}
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers: testFakeLibratoProviders(server),
+		Steps: []resource.TestStep{
+			{
+				Config: testFakeLibratoProviderConfig + testLibratoChartSnapshotConfig("600"),
+				Check: resource.ComposeTestCheckFunc(
+					snapshots(1),
+					resource.TestCheckResourceAttr(
+						"librato_chart_snapshot.foobar", "image_href", "https://snapshots.librato.com/chart/3.png"),
+				),
+			},
+			{
+				Config: testFakeLibratoProviderConfig + testLibratoChartSnapshotConfig("600"),
+				Check:  snapshots(1),
+			},
+			{
+				Config: testFakeLibratoProviderConfig + testLibratoChartSnapshotConfig("1200"),
+				Check: resource.ComposeTestCheckFunc(
+					snapshots(2),
+					resource.TestCheckResourceAttr(
+						"librato_chart_snapshot.foobar", "image_href", "https://snapshots.librato.com/chart/4.png"),
+				),
+			},
+		},
+	})
+}
+
+func testLibratoChartSnapshotConfig(duration string) string {
+	return fmt.Sprintf(`
+resource "librato_space" "foobar" {
+    name = "Foo Bar"
+}
+
+resource "librato_space_chart" "foobar" {
+    space_id = "${librato_space.foobar.id}"
+    name = "Foo Bar"
+    type = "line"
+    stream {
+      metric = "librato.cpu.percent.idle"
+      source = "*"
+    }
+}
+
+resource "librato_chart_snapshot" "foobar" {
+    space_id = "${librato_space.foobar.id}"
+    chart_id = "${librato_space_chart.foobar.id}"
+    duration = %s
+}`, duration)
+}
@@ -0,0 +1,136 @@
+package librato
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/henrikhodne/go-librato/librato"
+)
+
+func resourceLibratoMeasurement() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceLibratoMeasurementCreate,
+		Read:   resourceLibratoMeasurementRead,
+		Update: resourceLibratoMeasurementUpdate,
+		Delete: schema.RemoveFromState,
+
+		Schema: map[string]*schema.Schema{
+			"tags": {
+				Type:     schema.TypeMap,
+				Optional: true,
+			},
+			"period": {
+				Type:     schema.TypeInt,
+				Optional: true,
+			},
+			"measurement": {
+				Type:     schema.TypeList,
+				Required: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"name": {
+							Type:     schema.TypeString,
+							Required: true,
+						},
+						"value": {
+							Type:     schema.TypeFloat,
+							Required: true,
+						},
+						"tags": {
+							Type:     schema.TypeMap,
+							Optional: true,
+						},
+					},
+				},
+			},
+			"submitted_at": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+		},
+	}
+}
+
+func resourceLibratoMeasurementExpandTags(v interface{}) map[string]string {
+	tags := make(map[string]string)
+	for k, tv := range v.(map[string]interface{}) {
+		tags[k] = tv.(string)
+	}
+	return tags
+}
+
+func resourceLibratoMeasurementSubmit(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*Config).Client
+
+	now := time.Now()
+	submission := &librato.TaggedMeasurementSubmission{
+		Time: librato.Uint(uint(now.Unix())),
+	}
+	if v, ok := d.GetOk("tags"); ok {
+		submission.Tags = resourceLibratoMeasurementExpandTags(v)
+	}
+	if v, ok := d.GetOk("period"); ok {
+		submission.Period = librato.Uint(uint(v.(int)))
+	}
+	for i, m := range d.Get("measurement").([]interface{}) {
+		measurementData := m.(map[string]interface{})
+		measurement := &librato.TaggedMeasurement{
+			Name:  measurementData["name"].(string),
+			Value: librato.Float(measurementData["value"].(float64)),
+		}
+		if tags := resourceLibratoMeasurementExpandTags(measurementData["tags"]); len(tags) > 0 {
+			measurement.Tags = tags
+		} else if len(submission.Tags) == 0 {
+			// The API rejects tagless measurements one by one, after the rest
+			// of the batch has been accepted
+			return fmt.Errorf("measurement.%d (%s) has no tags, set tags on it or on the resource", i, measurement.Name)
+		}
+		submission.Measurements = append(submission.Measurements, measurement)
+	}
+
+	log.Printf("[INFO] Submitting %d Librato measurements", len(submission.Measurements))
+	result, err := client.Metrics.CreateTagged(submission)
+	if err != nil {
+		return fmt.Errorf("Error submitting Librato measurements: %s", err)
+	}
+	log.Printf("[INFO] Submitted Librato measurements: %d accepted, %d failed, %d filtered",
+		result.Summary.Accepted, result.Summary.Failed, result.Summary.Filtered)
+
+	if len(result.Errors) > 0 {
+		var buf bytes.Buffer
+		for _, e := range result.Errors {
+			fmt.Fprintf(&buf, "\n  * %s", e)
+		}
+		return fmt.Errorf("Error submitting Librato measurements, %d rejected:%s", result.Summary.Failed, buf.String())
+	}
+
+	d.Set("submitted_at", now.UTC().Format(time.RFC3339))
+	return nil
+}
+
+func resourceLibratoMeasurementCreate(d *schema.ResourceData, meta interface{}) error {
+	if err := resourceLibratoMeasurementSubmit(d, meta); err != nil {
+		return err
+	}
+
+	d.SetId(resource.UniqueId())
+	return resourceLibratoMeasurementRead(d, meta)
+}
+
+// Measurements can't be read back individually, the state is what was last
+// submitted.
+func resourceLibratoMeasurementRead(d *schema.ResourceData, meta interface{}) error {
+	return nil
+}
+
+func resourceLibratoMeasurementUpdate(d *schema.ResourceData, meta interface{}) error {
+	if err := resourceLibratoMeasurementSubmit(d, meta); err != nil {
+		return err
+	}
+
+	return resourceLibratoMeasurementRead(d, meta)
+}
@@ -0,0 +1,146 @@
+package librato
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform/helper/acctest"
+	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/henrikhodne/go-librato/librato"
+)
+
+func TestAccLibratoMeasurement_Basic(t *testing.T) {
+	name := fmt.Sprintf("tftest.measurement.%s", acctest.RandString(10))
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckLibratoMeasurementDestroy(name),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccCheckLibratoMeasurementConfig_basic(name, 99.9),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttrSet(
+						"librato_measurement.foobar", "submitted_at"),
+					testAccCheckLibratoMeasurementExists(name),
+				),
+			},
+			{
+				PreConfig: sleep(t, 5),
+				Config:    testAccCheckLibratoMeasurementConfig_basic(name, 99.95),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr(
+						"librato_measurement.foobar", "measurement.0.value", "99.95"),
+				),
+			},
+		},
+	})
+}
+
+// More measurements than fit in one request are split into batches, and the
+// measurements rejected in any of them are reported together.
+func TestResourceLibratoMeasurement_batches(t *testing.T) {
+	api, server := newFakeLibratoAPI()
+	defer server.Close()
+	baseURL, _ := url.Parse(server.URL + "/v1/")
+	meta := &Config{Client: librato.NewClientWithBaseURL(baseURL, "user", "token")}
+
+	var measurements []interface{}
+	for i := 0; i < 2*librato.MaxTaggedMeasurementsPerRequest+50; i++ {
+		name := fmt.Sprintf("batch.%d", i)
+		if i == 10 || i == 2*librato.MaxTaggedMeasurementsPerRequest+10 {
+			name = fmt.Sprintf("rejected.%d", i)
+		}
+		measurements = append(measurements, map[string]interface{}{"name": name, "value": float64(i)})
+	}
+	r := resourceLibratoMeasurement()
+	d := schema.TestResourceDataRaw(t, r.Schema, map[string]interface{}{
+		"tags":        map[string]interface{}{"environment": "test"},
+		"measurement": measurements,
+	})
+
+	err := r.Create(d, meta)
+	if err == nil {
+		t.Fatalf("Expected the rejected measurements to fail the create")
+	}
+	for _, want := range []string{"2 rejected", "rejected.10:", "rejected.610:"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("Expected %q in: %s", want, err)
+		}
+	}
+
+	posts := 0
+	for _, r := range api.requests {
+		if r == "POST measurements" {
+			posts++
+		}
+	}
+	if posts != 3 {
+		t.Fatalf("Expected 3 batches, got %d", posts)
+	}
+}
+
+func TestResourceLibratoMeasurement_untagged(t *testing.T) {
+	api, server := newFakeLibratoAPI()
+	defer server.Close()
+	baseURL, _ := url.Parse(server.URL + "/v1/")
+	meta := &Config{Client: librato.NewClientWithBaseURL(baseURL, "user", "token")}
+
+	r := resourceLibratoMeasurement()
+	d := schema.TestResourceDataRaw(t, r.Schema, map[string]interface{}{
+		"measurement": []interface{}{
+			map[string]interface{}{"name": "tagged", "value": 1.0, "tags": map[string]interface{}{"host": "web-1"}},
+			map[string]interface{}{"name": "untagged", "value": 2.0},
+		},
+	})
+	if err := r.Create(d, meta); err == nil || !strings.Contains(err.Error(), "measurement.1 (untagged) has no tags") {
+		t.Fatalf("Expected the untagged measurement to be rejected, got: %v", err)
+	}
+	if len(api.requests) != 0 {
+		t.Fatalf("Expected nothing to be submitted, got: %v", api.requests)
+	}
+}
+
+// Measurements outlive the resource, clean up the metric they created
+func testAccCheckLibratoMeasurementDestroy(name string) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		client := testAccProvider.Meta().(*Config).Client
+
+		_, err := client.Metrics.Delete(name)
+		return err
+	}
+}
+
+func testAccCheckLibratoMeasurementExists(name string) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		client := testAccProvider.Meta().(*Config).Client
+
+		return resource.Retry(1*time.Minute, func() *resource.RetryError {
+			if _, _, err := client.Metrics.Get(name); err != nil {
+				return resource.RetryableError(err)
+			}
+			return nil
+		})
+	}
+}
+
+func testAccCheckLibratoMeasurementConfig_basic(name string, value float64) string {
+	return fmt.Sprintf(`
+resource "librato_measurement" "foobar" {
+    tags {
+      environment = "test"
+    }
+    measurement {
+      name = "%s"
+      value = %g
+      tags {
+        kind = "slo_target"
+      }
+    }
+}`, name, value)
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/hashicorp/terraform/helper/resource"
@@ -39,14 +40,56 @@ func resourceLibratoMetric() *schema.Resource {
 			"period": {
 				Type:     schema.TypeInt,
 				Optional: true,
+				Computed: true,
 			},
 			"composite": {
 				Type:     schema.TypeString,
 				Optional: true,
 			},
+			"deletion_protection": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  true,
+			},
+			"retain_on_destroy": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+			"on_conflict": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Default:  "adopt",
+				ValidateFunc: func(v interface{}, k string) (ws []string, es []error) {
+					switch v.(string) {
+					case "adopt", "fail", "adopt_if_compatible":
+					default:
+						es = append(es, fmt.Errorf("%q must be one of adopt, fail or adopt_if_compatible", k))
+					}
+					return
+				},
+			},
+			"conflict_outcome": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"on_referenced": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Default:  "fail",
+				ValidateFunc: func(v interface{}, k string) (ws []string, es []error) {
+					switch v.(string) {
+					case "fail", "warn":
+					default:
+						es = append(es, fmt.Errorf("%q must be one of fail or warn", k))
+					}
+					return
+				},
+			},
 			"attributes": {
 				Type:     schema.TypeList,
 				Optional: true,
+				Computed: true,
 				MaxItems: 1,
 				Elem: &schema.Resource{
 					Schema: map[string]*schema.Schema{
@@ -54,26 +97,40 @@ func resourceLibratoMetric() *schema.Resource {
 							Type:     schema.TypeString,
 							Optional: true,
 						},
-						"display_max": {
+						"display_max": libratoNullableFloatSchema(),
+						"display_min": libratoNullableFloatSchema(),
+						"display_units_long": {
 							Type:     schema.TypeString,
 							Optional: true,
 						},
-						"display_min": {
+						"display_units_short": {
 							Type:     schema.TypeString,
 							Optional: true,
 						},
-						"display_units_long": {
+						"display_stacked": {
+							Type:     schema.TypeBool,
+							Optional: true,
+							Computed: true,
+						},
+						"display_transform": {
 							Type:     schema.TypeString,
 							Optional: true,
 						},
-						"display_units_short": {
+						"summarize_function": {
 							Type:     schema.TypeString,
 							Optional: true,
+							ValidateFunc: func(v interface{}, k string) (ws []string, es []error) {
+								switch v.(string) {
+								case "average", "sum", "count", "min", "max":
+								default:
+									es = append(es, fmt.Errorf("%q must be one of average, sum, count, min or max", k))
+								}
+								return
+							},
 						},
-						"display_stacked": {
-							Type:     schema.TypeBool,
+						"source_lag": {
+							Type:     schema.TypeInt,
 							Optional: true,
-							Default:  false,
 						},
 						"created_by_ua": {
 							Type:     schema.TypeString,
@@ -82,10 +139,12 @@ func resourceLibratoMetric() *schema.Resource {
 						"gap_detection": {
 							Type:     schema.TypeBool,
 							Optional: true,
+							Computed: true,
 						},
 						"aggregate": {
 							Type:     schema.TypeBool,
 							Optional: true,
+							Computed: true,
 						},
 					},
 				},
@@ -95,10 +154,15 @@ func resourceLibratoMetric() *schema.Resource {
 }
 
 func resourceLibratoMetricCreate(d *schema.ResourceData, meta interface{}) error {
-	client := meta.(*librato.Client)
+	config := meta.(*Config)
+	client := config.Client
+
+	if err := config.checkPolicy("librato_metric", d); err != nil {
+		return err
+	}
 
 	metric := librato.Metric{
-		Name: librato.String(d.Get("name").(string)),
+		Name: librato.String(config.affixMetricName(d.Get("name").(string))),
 		Type: librato.String(d.Get("type").(string)),
 	}
 	if a, ok := d.GetOk("display_name"); ok {
@@ -111,56 +175,28 @@ func resourceLibratoMetricCreate(d *schema.ResourceData, meta interface{}) error
 		metric.Period = librato.Uint(uint(a.(int)))
 	}
 	if a, ok := d.GetOk("composite"); ok {
-		metric.Composite = librato.String(a.(string))
+		metric.Composite = librato.String(config.affixComposite(a.(string)))
 	}
 
-	if a, ok := d.GetOk("attributes"); ok {
-
-		attributeData := a.([]interface{})
-		attributeDataMap := attributeData[0].(map[string]interface{})
-		attributes := new(librato.MetricAttributes)
-
-		if v, ok := attributeDataMap["color"].(string); ok && v != "" {
-			attributes.Color = librato.String(v)
-		}
-		if v, ok := attributeDataMap["display_max"].(string); ok && v != "" {
-			attributes.DisplayMax = librato.String(v)
-		}
-		if v, ok := attributeDataMap["display_min"].(string); ok && v != "" {
-			attributes.DisplayMin = librato.String(v)
-		}
-		if v, ok := attributeDataMap["display_units_long"].(string); ok && v != "" {
-			attributes.DisplayUnitsLong = *librato.String(v)
-		}
-		if v, ok := attributeDataMap["display_units_short"].(string); ok && v != "" {
-			attributes.DisplayUnitsShort = *librato.String(v)
-		}
-		if v, ok := attributeDataMap["created_by_ua"].(string); ok && v != "" {
-			attributes.CreatedByUA = *librato.String(v)
-		}
-		if v, ok := attributeDataMap["display_stacked"].(bool); ok {
-			attributes.DisplayStacked = *librato.Bool(v)
-		}
-		if v, ok := attributeDataMap["gap_detection"].(bool); ok {
-			attributes.GapDetection = *librato.Bool(v)
-		}
-		if v, ok := attributeDataMap["aggregate"].(bool); ok {
-			attributes.Aggregate = *librato.Bool(v)
-		}
+	if _, ok := d.GetOk("attributes"); ok {
+		metric.Attributes = resourceLibratoMetricAttributesExpand(d)
+	}
 
-		metric.Attributes = attributes
+	outcome, err := resourceLibratoMetricResolveConflict(d, client, &metric)
+	if err != nil {
+		return err
 	}
 
-	_, err := client.Metrics.Update(&metric)
+	_, err = client.Metrics.Update(&metric)
 	if err != nil {
 		log.Printf("[INFO] ERROR creating Metric: %s", err)
-		return fmt.Errorf("Error creating Librato metric: %s", err)
+		return fmt.Errorf("Error creating Librato metric: %s", libratoAttributeError(d, resourceLibratoMetric().Schema, err))
 	}
 
 	retryErr := resource.Retry(1*time.Minute, func() *resource.RetryError {
 		_, _, err := client.Metrics.Get(*metric.Name)
 		if err != nil {
-			if errResp, ok := err.(*librato.ErrorResponse); ok && errResp.Response.StatusCode == 404 {
+			if librato.IsNotFound(err) {
 				return resource.RetryableError(err)
 			}
 			return resource.NonRetryableError(err)
@@ -171,26 +207,124 @@ func resourceLibratoMetricCreate(d *schema.ResourceData, meta interface{}) error
 		return fmt.Errorf("Error creating Librato metric: %s", retryErr)
 	}
 
+	config.cache.evictMetric(*metric.Name)
 	d.SetId(*metric.Name)
+	d.Set("conflict_outcome", outcome)
+	config.annotateChange(d, "librato_metric", "created", *metric.Name, nil)
 	return resourceLibratoMetricRead(d, meta)
 }
 
+// Metrics are created with a PUT, which silently takes over a metric of the
+// same name. Checks for an existing metric and applies on_conflict to it,
+// returning whether the metric is "created" or "adopted".
+func resourceLibratoMetricResolveConflict(d *schema.ResourceData, client *librato.Client, metric *librato.Metric) (string, error) {
+	name := *metric.Name
+
+	existing, _, err := client.Metrics.Get(name)
+	if err != nil {
+		if librato.IsNotFound(err) {
+			return "created", nil
+		}
+		return "", fmt.Errorf("Error reading Librato Metric %s: %s", name, err)
+	}
+
+	switch onConflict := d.Get("on_conflict").(string); onConflict {
+	case "fail":
+		return "", fmt.Errorf("Librato metric %s already exists and on_conflict is %q. "+
+			"Import it or set on_conflict to \"adopt\" to manage it", name, onConflict)
+	case "adopt_if_compatible":
+		if existingType := stringValue(existing.Type); existingType != *metric.Type {
+			return "", fmt.Errorf("Librato metric %s already exists with type %q, refusing to adopt it as %q",
+				name, existingType, *metric.Type)
+		}
+		if existingComposite := stringValue(existing.Composite); existingComposite != stringValue(metric.Composite) {
+			return "", fmt.Errorf("Librato metric %s already exists with composite %q, refusing to adopt it with composite %q",
+				name, existingComposite, stringValue(metric.Composite))
+		}
+	}
+
+	// Attributes are replaced as a whole, keep those set outside of Terraform
+	if existing.Attributes != nil && metric.Attributes != nil {
+		metric.Attributes.Extra = existing.Attributes.Extra
+	}
+
+	log.Printf("[INFO] Adopting existing Librato Metric %s", name)
+	return "adopted", nil
+}
+
+// Lists the alerts whose conditions and the charts whose streams use the
+// metric, directly or in a composite.
+func resourceLibratoMetricReferences(client *librato.Client, name string) ([]string, error) {
+	var references []string
+
+	alerts, err := libratoListAlerts(client, "")
+	if err != nil {
+		return nil, err
+	}
+	for _, alert := range alerts {
+		for _, c := range alert.Conditions {
+			if stringValue(c.MetricName) == name {
+				references = append(references, fmt.Sprintf("alert %q (%d)", stringValue(alert.Name), *alert.ID))
+				break
+			}
+		}
+	}
+
+	spaces, err := libratoListSpaces(client, "")
+	if err != nil {
+		return nil, err
+	}
+	for _, space := range spaces {
+		charts, _, err := client.Spaces.ListCharts(*space.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, chart := range charts {
+			for _, s := range chart.Streams {
+				if stringValue(s.Metric) == name || compositeReferencesMetric(stringValue(s.Composite), name) {
+					references = append(references, fmt.Sprintf("chart %q (%d) in space %q (%d)",
+						stringValue(chart.Name), *chart.ID, stringValue(space.Name), *space.ID))
+					break
+				}
+			}
+		}
+	}
+
+	return references, nil
+}
+
+func compositeReferencesMetric(composite, name string) bool {
+	for _, m := range compositeMetricNameRegexp.FindAllStringSubmatchIndex(composite, -1) {
+		if start, end := compositeMetricNameIndex(m); composite[start:end] == name {
+			return true
+		}
+	}
+	return false
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
 func resourceLibratoMetricRead(d *schema.ResourceData, meta interface{}) error {
-	client := meta.(*librato.Client)
+	config := meta.(*Config)
 
 	id := d.Id()
 
 	log.Printf("[INFO] Reading Librato Metric: %s", id)
-	metric, _, err := client.Metrics.Get(id)
+	metric, err := config.cache.getMetric(id)
 	if err != nil {
-		if errResp, ok := err.(*librato.ErrorResponse); ok && errResp.Response.StatusCode == 404 {
+		if librato.IsNotFound(err) {
 			d.SetId("")
 			return nil
 		}
 		return fmt.Errorf("Error reading Librato Metric %s: %s", id, err)
 	}
 
-	d.Set("name", metric.Name)
+	d.Set("name", config.stripMetricName(*metric.Name))
 	d.Set("type", metric.Type)
 
 	if metric.Description != nil {
@@ -206,7 +340,7 @@ func resourceLibratoMetricRead(d *schema.ResourceData, meta interface{}) error {
 	}
 
 	if metric.Composite != nil {
-		d.Set("composite", metric.Composite)
+		d.Set("composite", config.stripComposite(*metric.Composite))
 	}
 
 	attributes := metricAttributesGather(d, metric.Attributes)
@@ -221,10 +355,21 @@ func resourceLibratoMetricRead(d *schema.ResourceData, meta interface{}) error {
 }
 
 func resourceLibratoMetricUpdate(d *schema.ResourceData, meta interface{}) error {
-	client := meta.(*librato.Client)
+	config := meta.(*Config)
+	client := config.Client
+
+	if err := config.checkPolicy("librato_metric", d); err != nil {
+		return err
+	}
 
 	id := d.Id()
 
+	// deletion_protection and retain_on_destroy only live in the state
+	if !d.HasChange("type") && !d.HasChange("description") && !d.HasChange("display_name") &&
+		!d.HasChange("period") && !d.HasChange("composite") && !d.HasChange("attributes") {
+		return resourceLibratoMetricRead(d, meta)
+	}
+
 	metric := new(librato.Metric)
 	metric.Name = librato.String(id)
 
@@ -241,48 +386,26 @@ func resourceLibratoMetricUpdate(d *schema.ResourceData, meta interface{}) error
 		metric.Period = librato.Uint(uint(d.Get("period").(int)))
 	}
 	if d.HasChange("composite") {
-		metric.Composite = librato.String(d.Get("composite").(string))
+		metric.Composite = librato.String(config.affixComposite(d.Get("composite").(string)))
 	}
 	if d.HasChange("attributes") {
-		attributeData := d.Get("attributes").([]interface{})
-		attributeDataMap := attributeData[0].(map[string]interface{})
-		attributes := new(librato.MetricAttributes)
-
-		if v, ok := attributeDataMap["color"].(string); ok && v != "" {
-			attributes.Color = librato.String(v)
-		}
-		if v, ok := attributeDataMap["display_max"].(string); ok && v != "" {
-			attributes.DisplayMax = librato.String(v)
-		}
-		if v, ok := attributeDataMap["display_min"].(string); ok && v != "" {
-			attributes.DisplayMin = librato.String(v)
-		}
-		if v, ok := attributeDataMap["display_units_long"].(string); ok && v != "" {
-			attributes.DisplayUnitsLong = *librato.String(v)
-		}
-		if v, ok := attributeDataMap["display_units_short"].(string); ok && v != "" {
-			attributes.DisplayUnitsShort = *librato.String(v)
-		}
-		if v, ok := attributeDataMap["created_by_ua"].(string); ok && v != "" {
-			attributes.CreatedByUA = *librato.String(v)
-		}
-		if v, ok := attributeDataMap["display_stacked"].(bool); ok {
-			attributes.DisplayStacked = *librato.Bool(v)
-		}
-		if v, ok := attributeDataMap["gap_detection"].(bool); ok {
-			attributes.GapDetection = *librato.Bool(v)
+		metric.Attributes = resourceLibratoMetricAttributesExpand(d)
+		// Attributes are replaced as a whole, keep those set outside of Terraform
+		current, _, err := client.Metrics.Get(id)
+		if err != nil {
+			return fmt.Errorf("Error reading Librato Metric %s: %s", id, err)
 		}
-		if v, ok := attributeDataMap["aggregate"].(bool); ok {
-			attributes.Aggregate = *librato.Bool(v)
+		if current.Attributes != nil && metric.Attributes != nil {
+			metric.Attributes.Extra = current.Attributes.Extra
 		}
-		metric.Attributes = attributes
 	}
 
 	log.Printf("[INFO] Updating Librato metric: %v", structToString(metric))
 
 	_, err := client.Metrics.Update(metric)
+	config.cache.evictMetric(id)
 	if err != nil {
-		return fmt.Errorf("Error updating Librato metric: %s", err)
+		return fmt.Errorf("Error updating Librato metric: %s", libratoAttributeError(d, resourceLibratoMetric().Schema, err))
 	}
 
 	log.Printf("[INFO] Updated Librato metric %s", id)
@@ -309,17 +432,43 @@ func resourceLibratoMetricUpdate(d *schema.ResourceData, meta interface{}) error
 		log.Printf("[INFO] ERROR - Failed updating Librato Metric %s: %s", id, err)
 		return fmt.Errorf("Failed updating Librato Metric %s: %s", id, err)
 	}
+	config.annotateChange(d, "librato_metric", "updated", id, resourceLibratoMetric().Schema)
 
 	return resourceLibratoMetricRead(d, meta)
 }
 
 func resourceLibratoMetricDelete(d *schema.ResourceData, meta interface{}) error {
-	client := meta.(*librato.Client)
+	config := meta.(*Config)
+	client := config.Client
 
 	id := d.Id()
 
+	if d.Get("retain_on_destroy").(bool) {
+		log.Printf("[INFO] Retaining Metric %s, removing it from state only", id)
+		d.SetId("")
+		return nil
+	}
+	if d.Get("deletion_protection").(bool) {
+		return fmt.Errorf("Librato metric %s has deletion_protection enabled, deleting it "+
+			"would discard all of its historical data. Set deletion_protection = false and "+
+			"apply before destroying it, or set retain_on_destroy = true to only remove it from state", id)
+	}
+
+	references, err := resourceLibratoMetricReferences(client, id)
+	if err != nil {
+		return fmt.Errorf("Error looking up references to Librato metric %s: %s", id, err)
+	}
+	if len(references) > 0 {
+		message := fmt.Sprintf("Librato metric %s is still used by %s", id, strings.Join(references, ", "))
+		if d.Get("on_referenced").(string) != "warn" {
+			return fmt.Errorf("%s. Remove it from them, or set on_referenced = \"warn\" to delete it anyway", message)
+		}
+		log.Printf("[WARN] %s, deleting it anyway", message)
+	}
+
 	log.Printf("[INFO] Deleting Metric: %s", id)
-	_, err := client.Metrics.Delete(id)
+	defer config.cache.evictMetric(id)
+	_, err = client.Metrics.Delete(id)
 	if err != nil {
 		return fmt.Errorf("Error deleting Metric: %s", err)
 	}
@@ -330,7 +479,7 @@ func resourceLibratoMetricDelete(d *schema.ResourceData, meta interface{}) error
 		log.Printf("[INFO] Getting Metric %s", id)
 		_, _, err := client.Metrics.Get(id)
 		if err != nil {
-			if errResp, ok := err.(*librato.ErrorResponse); ok && errResp.Response.StatusCode == 404 {
+			if librato.IsNotFound(err) {
 				log.Printf("[INFO] Metric %s not found, removing from state", id)
 				return nil
 			}
@@ -344,7 +493,56 @@ func resourceLibratoMetricDelete(d *schema.ResourceData, meta interface{}) error
 	if retryErr != nil {
 		return fmt.Errorf("Error deleting librato metric: %s", retryErr)
 	}
+	config.annotateChange(d, "librato_metric", "deleted", id, nil)
+
+	return nil
+}
+
+// Expands the attributes block. Flags the API defaults are only sent when
+// they are set or changed, false can't be told apart from unset otherwise.
+func resourceLibratoMetricAttributesExpand(d *schema.ResourceData) *librato.MetricAttributes {
+	attributeData := d.Get("attributes").([]interface{})
+	if len(attributeData) == 0 || attributeData[0] == nil {
+		return nil
+	}
+	attributeDataMap := attributeData[0].(map[string]interface{})
+	attributes := new(librato.MetricAttributes)
+
+	if v, ok := attributeDataMap["color"].(string); ok && v != "" {
+		attributes.Color = librato.String(v)
+	}
+	attributes.DisplayMax = libratoNullableFloatExpand(attributeDataMap["display_max"])
+	attributes.DisplayMin = libratoNullableFloatExpand(attributeDataMap["display_min"])
+	if v, ok := attributeDataMap["display_units_long"].(string); ok && v != "" {
+		attributes.DisplayUnitsLong = v
+	}
+	if v, ok := attributeDataMap["display_units_short"].(string); ok && v != "" {
+		attributes.DisplayUnitsShort = v
+	}
+	if v, ok := attributeDataMap["display_transform"].(string); ok && v != "" {
+		attributes.DisplayTransform = v
+	}
+	if v, ok := attributeDataMap["summarize_function"].(string); ok && v != "" {
+		attributes.SummarizeFunction = v
+	}
+	if v, ok := attributeDataMap["source_lag"].(int); ok && v > 0 {
+		attributes.SourceLag = uint(v)
+	}
+	if v, ok := attributeDataMap["created_by_ua"].(string); ok && v != "" {
+		attributes.CreatedByUA = v
+	}
+	attributes.DisplayStacked = resourceLibratoMetricAttributeBool(d, "display_stacked")
+	attributes.GapDetection = resourceLibratoMetricAttributeBool(d, "gap_detection")
+	attributes.Aggregate = resourceLibratoMetricAttributeBool(d, "aggregate")
+
+	return attributes
+}
 
+func resourceLibratoMetricAttributeBool(d *schema.ResourceData, name string) *bool {
+	key := "attributes.0." + name
+	if v, ok := d.GetOk(key); ok || d.HasChange(key) {
+		return librato.Bool(v.(bool))
+	}
 	return nil
 }
 
@@ -357,24 +555,35 @@ func metricAttributesGather(d *schema.ResourceData, attributes *librato.MetricAt
 		if attributes.Color != nil {
 			retAttributes["color"] = *attributes.Color
 		}
-		if attributes.DisplayMax != nil {
-			retAttributes["display_max"] = attributes.DisplayMax
-		}
-		if attributes.DisplayMin != nil {
-			retAttributes["display_min"] = attributes.DisplayMin
-		}
+		retAttributes["display_max"] = libratoNullableFloatFlatten(attributes.DisplayMax)
+		retAttributes["display_min"] = libratoNullableFloatFlatten(attributes.DisplayMin)
 		if attributes.DisplayUnitsLong != "" {
 			retAttributes["display_units_long"] = attributes.DisplayUnitsLong
 		}
 		if attributes.DisplayUnitsShort != "" {
 			retAttributes["display_units_short"] = attributes.DisplayUnitsShort
 		}
+		if attributes.DisplayTransform != "" {
+			retAttributes["display_transform"] = attributes.DisplayTransform
+		}
+		if attributes.SummarizeFunction != "" {
+			retAttributes["summarize_function"] = attributes.SummarizeFunction
+		}
+		if attributes.SourceLag != 0 {
+			retAttributes["source_lag"] = int(attributes.SourceLag)
+		}
 		if attributes.CreatedByUA != "" {
 			retAttributes["created_by_ua"] = attributes.CreatedByUA
 		}
-		retAttributes["display_stacked"] = attributes.DisplayStacked || false
-		retAttributes["gap_detection"] = attributes.GapDetection || false
-		retAttributes["aggregate"] = attributes.Aggregate || false
+		if attributes.DisplayStacked != nil {
+			retAttributes["display_stacked"] = *attributes.DisplayStacked
+		}
+		if attributes.GapDetection != nil {
+			retAttributes["gap_detection"] = *attributes.GapDetection
+		}
+		if attributes.Aggregate != nil {
+			retAttributes["aggregate"] = *attributes.Aggregate
+		}
 
 		result = append(result, retAttributes)
 	}
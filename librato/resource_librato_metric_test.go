@@ -1,12 +1,17 @@
 package librato
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/url"
+	"regexp"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/terraform/helper/acctest"
 	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/helper/schema"
 	"github.com/hashicorp/terraform/terraform"
 	"github.com/henrikhodne/go-librato/librato"
 )
@@ -31,6 +36,8 @@ func TestAccLibratoMetrics(t *testing.T) {
 					testAccCheckLibratoMetricType(&metric, typ),
 					resource.TestCheckResourceAttr(
 						"librato_metric.foobar", "name", name),
+					resource.TestCheckResourceAttr(
+						"librato_metric.foobar", "conflict_outcome", "created"),
 				),
 			},
 			{
@@ -117,8 +124,314 @@ func TestAccLibratoMetrics(t *testing.T) {
 	})
 }
 
+func TestAccLibratoMetric_DeletionProtection(t *testing.T) {
+	var metric librato.Metric
+	name := fmt.Sprintf("tftest-metric-%s", acctest.RandString(10))
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckLibratoMetricDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: protectedMetricConfig(name, "deletion_protection = true"),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckLibratoMetricExists("librato_metric.foobar", &metric),
+					resource.TestCheckResourceAttr(
+						"librato_metric.foobar", "deletion_protection", "true"),
+				),
+			},
+			{
+				Config:      protectedMetricConfig(name, "deletion_protection = true"),
+				Destroy:     true,
+				ExpectError: regexp.MustCompile("deletion_protection enabled"),
+			},
+			{
+				Config: protectedMetricConfig(name, "deletion_protection = false"),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckLibratoMetricExists("librato_metric.foobar", &metric),
+					resource.TestCheckResourceAttr(
+						"librato_metric.foobar", "deletion_protection", "false"),
+				),
+			},
+		},
+	})
+}
+
+func TestAccLibratoMetric_RetainOnDestroy(t *testing.T) {
+	var metric librato.Metric
+	name := fmt.Sprintf("tftest-metric-%s", acctest.RandString(10))
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckLibratoMetricRetained(name),
+		Steps: []resource.TestStep{
+			{
+				Config: protectedMetricConfig(name, "retain_on_destroy = true"),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckLibratoMetricExists("librato_metric.foobar", &metric),
+				),
+			},
+		},
+	})
+}
+
+func TestAccLibratoMetric_OnConflict(t *testing.T) {
+	var metric librato.Metric
+	name := fmt.Sprintf("tftest-metric-%s", acctest.RandString(10))
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckLibratoMetricDestroy,
+		Steps: []resource.TestStep{
+			{
+				PreConfig:   testAccCreateLibratoMetric(t, name, "gauge"),
+				Config:      conflictMetricConfig(name, "counter", "fail"),
+				ExpectError: regexp.MustCompile("already exists"),
+			},
+			{
+				Config:      conflictMetricConfig(name, "counter", "adopt_if_compatible"),
+				ExpectError: regexp.MustCompile("refusing to adopt"),
+			},
+			{
+				Config: conflictMetricConfig(name, "gauge", "adopt_if_compatible"),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckLibratoMetricExists("librato_metric.foobar", &metric),
+					testAccCheckLibratoMetricType(&metric, "gauge"),
+					resource.TestCheckResourceAttr(
+						"librato_metric.foobar", "conflict_outcome", "adopted"),
+				),
+			},
+		},
+	})
+}
+
+func TestAccLibratoMetric_OnReferenced(t *testing.T) {
+	var metric librato.Metric
+	var alert librato.Alert
+	name := fmt.Sprintf("tftest-metric-%s", acctest.RandString(10))
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckLibratoMetricReferencedDestroy(&alert),
+		Steps: []resource.TestStep{
+			{
+				Config: referencedMetricConfig(name, "fail"),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckLibratoMetricExists("librato_metric.foobar", &metric),
+					testAccCreateLibratoAlertUsingMetric(&metric, &alert),
+				),
+			},
+			{
+				Config:      referencedMetricConfig(name, "fail"),
+				Destroy:     true,
+				ExpectError: regexp.MustCompile("still used by alert"),
+			},
+			{
+				Config: referencedMetricConfig(name, "warn"),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr(
+						"librato_metric.foobar", "on_referenced", "warn"),
+				),
+			},
+		},
+	})
+}
+
+func TestResourceLibratoMetricReferences_paginated(t *testing.T) {
+	api, server := newFakeLibratoAPI()
+	defer server.Close()
+	api.pageSize = 2
+	baseURL, _ := url.Parse(server.URL + "/v1/")
+	client := librato.NewClientWithBaseURL(baseURL, "user", "token")
+
+	var space *librato.Space
+	for i := 0; i < 5; i++ {
+		var err error
+		if space, _, err = client.Spaces.Create(&librato.Space{Name: librato.String(fmt.Sprintf("space %d", i))}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	chart := &librato.SpaceChart{
+		Name:    librato.String("requests"),
+		Streams: []librato.SpaceChartStream{{Metric: librato.String("api.requests")}},
+	}
+	if _, _, err := client.Spaces.CreateChart(*space.ID, chart); err != nil {
+		t.Fatal(err)
+	}
+
+	references, err := resourceLibratoMetricReferences(client, "api.requests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(references) != 1 || !strings.Contains(references[0], `in space "space 4"`) {
+		t.Fatalf("Expected the chart in the last space to be found, got: %v", references)
+	}
+}
+
+func TestCompositeReferencesMetric(t *testing.T) {
+	for _, composite := range []string{
+		`divide([sum(s("api.errors", "*")), sum(series("api.requests", "*"))])`,
+		`divide([sum(s('api.errors', '*')), sum(series('api.requests', '*'))])`,
+	} {
+		if !compositeReferencesMetric(composite, "api.requests") {
+			t.Fatalf("Expected %s to reference api.requests", composite)
+		}
+		if compositeReferencesMetric(composite, "api") {
+			t.Fatalf("Expected %s not to reference api", composite)
+		}
+	}
+}
+
+func TestAccLibratoMetric_Attributes(t *testing.T) {
+	var metric librato.Metric
+	name := fmt.Sprintf("tftest-metric-%s", acctest.RandString(10))
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckLibratoMetricDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: attributesMetricConfig(name),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckLibratoMetricExists("librato_metric.foobar", &metric),
+					resource.TestCheckResourceAttr("librato_metric.foobar", "attributes.0.display_min", "0"),
+					resource.TestCheckResourceAttr("librato_metric.foobar", "attributes.0.display_max", "100"),
+					resource.TestCheckResourceAttr("librato_metric.foobar", "attributes.0.summarize_function", "max"),
+					resource.TestCheckResourceAttr("librato_metric.foobar", "attributes.0.display_transform", "x/1000"),
+				),
+			},
+			// Reapplying must not show a diff
+			{
+				Config:   attributesMetricConfig(name),
+				PlanOnly: true,
+			},
+		},
+	})
+}
+
+func TestMetricAttributesJSON(t *testing.T) {
+	var attributes librato.MetricAttributes
+	raw := `{"display_min": "0", "display_max": 100, "summarize_function": "max", "display_transform": "x/1000", "display_units_short": "ms", "created_by_ui": true}`
+	if err := json.Unmarshal([]byte(raw), &attributes); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if attributes.DisplayMin == nil || *attributes.DisplayMin != 0 {
+		t.Fatalf("Expected display_min given as a string to be decoded as 0, got %v", attributes.DisplayMin)
+	}
+	if attributes.DisplayMax == nil || *attributes.DisplayMax != 100 {
+		t.Fatalf("Bad display_max: %v", attributes.DisplayMax)
+	}
+	if attributes.Extra["created_by_ui"] != true || len(attributes.Extra) != 1 {
+		t.Fatalf("Expected the unknown attribute to be kept in Extra, got %v", attributes.Extra)
+	}
+
+	encoded, err := json.Marshal(attributes)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	var roundTripped map[string]interface{}
+	json.Unmarshal(encoded, &roundTripped)
+	if roundTripped["created_by_ui"] != true || roundTripped["summarize_function"] != "max" {
+		t.Fatalf("Attributes didn't survive being written back: %s", encoded)
+	}
+
+	gathered := metricAttributesGather(nil, &librato.MetricAttributes{DisplayMin: librato.Float(0)})
+	if gathered[0]["display_max"] != "" || gathered[0]["display_min"] != "0" {
+		t.Fatalf("Bad gathered display bounds: %q %q", gathered[0]["display_min"], gathered[0]["display_max"])
+	}
+	d := schema.TestResourceDataRaw(t, resourceLibratoMetric().Schema, map[string]interface{}{
+		"name":       "foo",
+		"type":       "gauge",
+		"attributes": []interface{}{gathered[0]},
+	})
+	expanded := resourceLibratoMetricAttributesExpand(d)
+	if expanded.DisplayMax != nil || expanded.DisplayMin == nil || *expanded.DisplayMin != 0 {
+		t.Fatalf("Bad expanded display bounds: %v %v", expanded.DisplayMin, expanded.DisplayMax)
+	}
+	if expanded.DisplayStacked != nil {
+		t.Fatalf("Expected an unset display_stacked to be left to the API, got %v", *expanded.DisplayStacked)
+	}
+}
+
+// Creates an alert outside of Terraform on the metric
+func testAccCreateLibratoAlertUsingMetric(metric *librato.Metric, alert *librato.Alert) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		client := testAccProvider.Meta().(*Config).Client
+
+		created, _, err := client.Alerts.Create(&librato.Alert{
+			Name: librato.String(fmt.Sprintf("tftest-alert-%s", acctest.RandString(10))),
+			Conditions: []librato.AlertCondition{
+				{
+					Type:       librato.String("above"),
+					MetricName: metric.Name,
+					Threshold:  librato.Float(10),
+				},
+			},
+		})
+		if err != nil {
+			return err
+		}
+
+		*alert = *created
+		return nil
+	}
+}
+
+func testAccCheckLibratoMetricReferencedDestroy(alert *librato.Alert) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		client := testAccProvider.Meta().(*Config).Client
+
+		if _, err := client.Alerts.Delete(*alert.ID); err != nil {
+			return err
+		}
+		return testAccCheckLibratoMetricDestroy(s)
+	}
+}
+
+// Creates a metric outside of Terraform
+func testAccCreateLibratoMetric(t *testing.T, name, typ string) func() {
+	return func() {
+		client := testAccProvider.Meta().(*Config).Client
+
+		metric := &librato.Metric{
+			Name: librato.String(name),
+			Type: librato.String(typ),
+		}
+		if _, err := client.Metrics.Update(metric); err != nil {
+			t.Fatalf("Error creating Librato metric %s: %s", name, err)
+		}
+		if err := resource.Retry(1*time.Minute, func() *resource.RetryError {
+			if _, _, err := client.Metrics.Get(name); err != nil {
+				return resource.RetryableError(err)
+			}
+			return nil
+		}); err != nil {
+			t.Fatalf("Error waiting for Librato metric %s: %s", name, err)
+		}
+	}
+}
+
+// Checks the metric outlived the resource, and cleans it up
+func testAccCheckLibratoMetricRetained(name string) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		client := testAccProvider.Meta().(*Config).Client
+
+		if _, _, err := client.Metrics.Get(name); err != nil {
+			return fmt.Errorf("Metric wasn't retained: %s", err)
+		}
+
+		_, err := client.Metrics.Delete(name)
+		return err
+	}
+}
+
 func testAccCheckLibratoMetricDestroy(s *terraform.State) error {
-	client := testAccProvider.Meta().(*librato.Client)
+	client := testAccProvider.Meta().(*Config).Client
 
 	for _, rs := range s.RootModule().Resources {
 		if rs.Type != "librato_metric" {
@@ -176,7 +489,7 @@ func testAccCheckLibratoMetricExists(n string, metric *librato.Metric) resource.
 			return fmt.Errorf("No Metric ID is set")
 		}
 
-		client := testAccProvider.Meta().(*librato.Client)
+		client := testAccProvider.Meta().(*Config).Client
 
 		foundMetric, _, err := client.Metrics.Get(rs.Primary.ID)
 
@@ -200,6 +513,7 @@ func counterMetricConfig(name, typ, desc string) string {
         name = "%s"
         type = "%s"
         description = "%s"
+        deletion_protection = false
         attributes {
           display_stacked = true
         }
@@ -212,6 +526,7 @@ func gaugeMetricConfig(name, typ, desc string) string {
         name = "%s"
         type = "%s"
         description = "%s"
+        deletion_protection = false
         attributes {
           display_stacked = true
         }
@@ -224,9 +539,57 @@ func compositeMetricConfig(name, typ, desc string) string {
         name = "%s"
         type = "%s"
         description = "%s"
+        deletion_protection = false
         composite = "s(\"librato.cpu.percent.user\", {\"environment\" : \"prod\", \"service\": \"api\"})"
         attributes {
           display_stacked = true
         }
     }`, name, typ, desc))
 }
+
+func attributesMetricConfig(name string) string {
+	return strings.TrimSpace(fmt.Sprintf(`
+    resource "librato_metric" "foobar" {
+        name = "%s"
+        type = "gauge"
+        description = "A test metric with attributes"
+        deletion_protection = false
+        attributes {
+          display_min = 0
+          display_max = 100
+          display_units_short = "ms"
+          display_transform = "x/1000"
+          summarize_function = "max"
+        }
+    }`, name))
+}
+
+func protectedMetricConfig(name, protection string) string {
+	return strings.TrimSpace(fmt.Sprintf(`
+    resource "librato_metric" "foobar" {
+        name = "%s"
+        type = "gauge"
+        description = "A protected test metric"
+        %s
+    }`, name, protection))
+}
+
+func conflictMetricConfig(name, typ, onConflict string) string {
+	return strings.TrimSpace(fmt.Sprintf(`
+    resource "librato_metric" "foobar" {
+        name = "%s"
+        type = "%s"
+        on_conflict = "%s"
+        deletion_protection = false
+    }`, name, typ, onConflict))
+}
+
+func referencedMetricConfig(name, onReferenced string) string {
+	return strings.TrimSpace(fmt.Sprintf(`
+    resource "librato_metric" "foobar" {
+        name = "%s"
+        type = "gauge"
+        on_referenced = "%s"
+        deletion_protection = false
+    }`, name, onReferenced))
+}
@@ -1,11 +1,17 @@
 package librato
 
 import (
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"math/big"
+	"os"
 	"reflect"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/hashicorp/terraform/helper/resource"
@@ -35,31 +41,50 @@ func resourceLibratoService() *schema.Resource {
 				Required: true,
 			},
 			"settings": {
-				Type:      schema.TypeString,
-				Required:  true,
-				StateFunc: normalizeJSON,
+				Type:         schema.TypeString,
+				Required:     true,
+				StateFunc:    normalizeJSON,
+				ValidateFunc: validateLibratoServiceSettings,
+			},
+			// Only hashes of the values are kept in the state
+			"sensitive_settings": {
+				Type:             schema.TypeMap,
+				Optional:         true,
+				Sensitive:        true,
+				DiffSuppressFunc: suppressLibratoSensitiveSettingDiff,
+			},
+			"force_detach": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
 			},
 		},
 	}
 }
 
-// Takes JSON in a string. Decodes JSON into
-// settings hash
-func resourceLibratoServicesExpandSettings(rawSettings string) (map[string]string, error) {
-	var settings map[string]string
+func validateLibratoServiceSettings(v interface{}, k string) (ws []string, es []error) {
+	if _, err := resourceLibratoServicesExpandSettings(v.(string)); err != nil {
+		es = append(es, fmt.Errorf("%q must be a JSON object: %s", k, err))
+	}
+	return
+}
 
-	settings = make(map[string]string)
-	err := json.Unmarshal([]byte(rawSettings), &settings)
-	if err != nil {
+// Takes JSON in a string. Decodes JSON into
+// settings hash, keeping the JSON type of every value
+func resourceLibratoServicesExpandSettings(rawSettings string) (map[string]interface{}, error) {
+	settings := make(map[string]interface{})
+	if err := decodeJSONNumbers(rawSettings, &settings); err != nil {
 		return nil, fmt.Errorf("Error decoding JSON: %s", err)
 	}
 
-	return settings, err
+	return settings, nil
 }
 
-// Encodes a settings hash into a JSON string
-func resourceLibratoServicesFlatten(settings map[string]string) (string, error) {
-	byteArray, err := json.Marshal(settings)
+// Encodes a settings hash into a JSON string. Like normalizeJSON the keys
+// are sorted and numbers formatted the same way, so settings read back
+// from Librato compare equal to the configured ones.
+func resourceLibratoServicesFlatten(settings map[string]interface{}) (string, error) {
+	byteArray, err := json.Marshal(canonicalJSONNumbers(settings))
 	if err != nil {
 		return "", fmt.Errorf("Error encoding to JSON: %s", err)
 	}
@@ -72,7 +97,7 @@ func normalizeJSON(jsonString interface{}) string {
 		return ""
 	}
 	var j interface{}
-	err := json.Unmarshal([]byte(jsonString.(string)), &j)
+	err := decodeJSONNumbers(jsonString.(string), &j)
 	if err != nil {
 		return fmt.Sprintf("Error parsing JSON: %s", err)
 	}
@@ -80,15 +105,72 @@ func normalizeJSON(jsonString interface{}) string {
 	return string(b[:])
 }
 
+// Decodes JSON with the numbers as json.Number in canonicalJSONNumbers form,
+// so that integers too large for a float64 keep their precision.
+func decodeJSONNumbers(s string, v interface{}) error {
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if dec.More() {
+		return fmt.Errorf("invalid character after top-level value")
+	}
+	switch v := v.(type) {
+	case *interface{}:
+		*v = canonicalJSONNumbers(*v)
+	case *map[string]interface{}:
+		*v = canonicalJSONNumbers(*v).(map[string]interface{})
+	}
+	return nil
+}
+
+// Formats the numbers in a decoded JSON value the same way however they were
+// written: integers with all their digits, e.g. 1.0 as 1, and other numbers
+// like encoding/json formats a float64, e.g. 1.50 as 1.5.
+func canonicalJSONNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[k] = canonicalJSONNumbers(e)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(v))
+		for i, e := range v {
+			l[i] = canonicalJSONNumbers(e)
+		}
+		return l
+	case json.Number:
+		if i, ok := new(big.Int).SetString(v.String(), 10); ok {
+			return json.Number(i.String())
+		}
+		if f, err := v.Float64(); err == nil {
+			b, _ := json.Marshal(f)
+			return json.Number(b)
+		}
+	case float64:
+		b, _ := json.Marshal(v)
+		return canonicalJSONNumbers(json.Number(b))
+	}
+	return v
+}
+
 func resourceLibratoServiceCreate(d *schema.ResourceData, meta interface{}) error {
-	client := meta.(*librato.Client)
+	config := meta.(*Config)
+	client := config.Client
+
+	if err := config.checkPolicy("librato_service", d); err != nil {
+		return err
+	}
 
 	service := new(librato.Service)
 	if v, ok := d.GetOk("type"); ok {
 		service.Type = librato.String(v.(string))
 	}
 	if v, ok := d.GetOk("title"); ok {
-		service.Title = librato.String(v.(string))
+		service.Title = librato.String(config.affixName(v.(string)))
 	}
 	if v, ok := d.GetOk("settings"); ok {
 		res, expandErr := resourceLibratoServicesExpandSettings(normalizeJSON(v.(string)))
@@ -97,17 +179,32 @@ func resourceLibratoServiceCreate(d *schema.ResourceData, meta interface{}) erro
 		}
 		service.Settings = res
 	}
+	if err := resourceLibratoServiceMergeSensitiveSettings(d, service); err != nil {
+		return err
+	}
 
-	serviceResult, _, err := client.Services.Create(service)
-
+	var serviceResult *librato.Service
+	err := libratoCreateWithRecovery(fmt.Sprintf("service %s", stringValue(service.Title)),
+		func() (err error) {
+			serviceResult, _, err = client.Services.Create(service)
+			return err
+		},
+		func(after uint) (uint, error) {
+			found, err := libratoFindService(client, stringValue(service.Type), stringValue(service.Title), after)
+			if found == nil {
+				return 0, err
+			}
+			serviceResult = found
+			return *found.ID, nil
+		})
 	if err != nil {
-		return fmt.Errorf("Error creating Librato service: %s", err)
+		return fmt.Errorf("Error creating Librato service: %s", libratoAttributeError(d, resourceLibratoService().Schema, err))
 	}
 
 	resource.Retry(1*time.Minute, func() *resource.RetryError {
 		_, _, err := client.Services.Get(*serviceResult.ID)
 		if err != nil {
-			if errResp, ok := err.(*librato.ErrorResponse); ok && errResp.Response.StatusCode == 404 {
+			if librato.IsNotFound(err) {
 				return resource.RetryableError(err)
 			}
 			return resource.NonRetryableError(err)
@@ -115,11 +212,12 @@ func resourceLibratoServiceCreate(d *schema.ResourceData, meta interface{}) erro
 		return nil
 	})
 
-	return resourceLibratoServiceReadResult(d, serviceResult)
+	return resourceLibratoServiceReadResult(d, config, serviceResult)
 }
 
 func resourceLibratoServiceRead(d *schema.ResourceData, meta interface{}) error {
-	client := meta.(*librato.Client)
+	config := meta.(*Config)
+	client := config.Client
 	id, err := strconv.ParseUint(d.Id(), 10, 0)
 	if err != nil {
 		return err
@@ -128,36 +226,64 @@ func resourceLibratoServiceRead(d *schema.ResourceData, meta interface{}) error
 	log.Printf("[INFO] Reading Librato Service: %d", id)
 	service, _, err := client.Services.Get(uint(id))
 	if err != nil {
-		if errResp, ok := err.(*librato.ErrorResponse); ok && errResp.Response.StatusCode == 404 {
+		if librato.IsNotFound(err) {
 			d.SetId("")
 			return nil
 		}
 		return fmt.Errorf("Error reading Librato Service %s: %s", d.Id(), err)
 	}
-	log.Printf("[INFO] Received Librato Service: %s", service)
+	log.Printf("[INFO] Received Librato Service: %s", resourceLibratoServiceRedacted(d, service))
 
-	return resourceLibratoServiceReadResult(d, service)
+	return resourceLibratoServiceReadResult(d, config, service)
 }
 
-func resourceLibratoServiceReadResult(d *schema.ResourceData, service *librato.Service) error {
+func resourceLibratoServiceReadResult(d *schema.ResourceData, config *Config, service *librato.Service) error {
 	d.SetId(strconv.FormatUint(uint64(*service.ID), 10))
 	d.Set("id", *service.ID)
 	d.Set("type", *service.Type)
-	d.Set("title", *service.Title)
-	settings, _ := resourceLibratoServicesFlatten(service.Settings)
+	d.Set("title", config.stripName(*service.Title))
+
+	// Sensitive settings are split off, so their values stay out of settings
+	isSensitive := resourceLibratoServiceSensitiveKeys(d, *service.Type)
+	publicSettings := make(map[string]interface{})
+	sensitiveHashes := make(map[string]interface{})
+	for k, v := range service.Settings {
+		if isSensitive(k) {
+			sensitiveHashes[k] = libratoSensitiveHash(libratoSettingString(v))
+			continue
+		}
+		publicSettings[k] = v
+	}
+	if service.Settings == nil {
+		publicSettings = nil
+	}
+	settings, _ := resourceLibratoServicesFlatten(publicSettings)
 	d.Set("settings", settings)
+	if err := d.Set("sensitive_settings", sensitiveHashes); err != nil {
+		return err
+	}
 
 	return nil
 }
 
 func resourceLibratoServiceUpdate(d *schema.ResourceData, meta interface{}) error {
-	client := meta.(*librato.Client)
+	config := meta.(*Config)
+	client := config.Client
+
+	if err := config.checkPolicy("librato_service", d); err != nil {
+		return err
+	}
 
 	serviceID, err := strconv.ParseUint(d.Id(), 10, 0)
 	if err != nil {
 		return err
 	}
 
+	// force_detach only lives in the state
+	if !d.HasChange("type") && !d.HasChange("title") && !d.HasChange("settings") && !d.HasChange("sensitive_settings") {
+		return resourceLibratoServiceRead(d, meta)
+	}
+
 	// Just to have whole object for comparison before/after update
 	fullService, _, err := client.Services.Get(uint(serviceID))
 	if err != nil {
@@ -170,22 +296,26 @@ func resourceLibratoServiceUpdate(d *schema.ResourceData, meta interface{}) erro
 		fullService.Type = service.Type
 	}
 	if d.HasChange("title") {
-		service.Title = librato.String(d.Get("title").(string))
+		service.Title = librato.String(config.affixName(d.Get("title").(string)))
 		fullService.Title = service.Title
 	}
-	if d.HasChange("settings") {
+	// Settings are replaced as a whole, so a change to either one sends both
+	if d.HasChange("settings") || d.HasChange("sensitive_settings") {
 		res, getErr := resourceLibratoServicesExpandSettings(normalizeJSON(d.Get("settings").(string)))
 		if getErr != nil {
 			return fmt.Errorf("Error expanding Librato service settings: %s", getErr)
 		}
 		service.Settings = res
-		fullService.Settings = res
+		if err := resourceLibratoServiceMergeSensitiveSettings(d, service); err != nil {
+			return err
+		}
+		fullService.Settings = service.Settings
 	}
 
-	log.Printf("[INFO] Updating Librato Service %d: %s", serviceID, service)
+	log.Printf("[INFO] Updating Librato Service %d: %s", serviceID, resourceLibratoServiceRedacted(d, service))
 	_, err = client.Services.Update(uint(serviceID), service)
 	if err != nil {
-		return fmt.Errorf("Error updating Librato service: %s", err)
+		return fmt.Errorf("Error updating Librato service: %s", libratoAttributeError(d, resourceLibratoService().Schema, err))
 	}
 	log.Printf("[INFO] Updated Librato Service %d", serviceID)
 
@@ -217,12 +347,16 @@ func resourceLibratoServiceUpdate(d *schema.ResourceData, meta interface{}) erro
 }
 
 func resourceLibratoServiceDelete(d *schema.ResourceData, meta interface{}) error {
-	client := meta.(*librato.Client)
+	client := meta.(*Config).Client
 	id, err := strconv.ParseUint(d.Id(), 10, 0)
 	if err != nil {
 		return err
 	}
 
+	if err := resourceLibratoServiceDetach(d, client, uint(id)); err != nil {
+		return err
+	}
+
 	log.Printf("[INFO] Deleting Service: %d", id)
 	_, err = client.Services.Delete(uint(id))
 	if err != nil {
@@ -232,7 +366,7 @@ func resourceLibratoServiceDelete(d *schema.ResourceData, meta interface{}) erro
 	resource.Retry(1*time.Minute, func() *resource.RetryError {
 		_, _, err := client.Services.Get(uint(id))
 		if err != nil {
-			if errResp, ok := err.(*librato.ErrorResponse); ok && errResp.Response.StatusCode == 404 {
+			if librato.IsNotFound(err) {
 				return nil
 			}
 			return resource.NonRetryableError(err)
@@ -243,3 +377,177 @@ func resourceLibratoServiceDelete(d *schema.ResourceData, meta interface{}) erro
 	d.SetId("")
 	return nil
 }
+
+// Sensitive setting values are either literal, or read from an environment
+// variable with "env:NAME" or from a file with "file:PATH".
+func libratoSensitiveValue(v string) (string, error) {
+	switch {
+	case strings.HasPrefix(v, "env:"):
+		name := strings.TrimPrefix(v, "env:")
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("Environment variable %s of sensitive setting is not set", name)
+		}
+		return value, nil
+	case strings.HasPrefix(v, "file:"):
+		path := strings.TrimPrefix(v, "file:")
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("Error reading sensitive setting: %s", err)
+		}
+		return strings.TrimRight(string(contents), "\r\n"), nil
+	}
+	return v, nil
+}
+
+func libratoSensitiveHash(v string) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(v)))
+}
+
+// Returns a setting value as the string it was configured as
+func libratoSettingString(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// The state holds hashes of the sensitive settings, which are compared to the
+// hash of the configured value.
+func suppressLibratoSensitiveSettingDiff(k, old, new string, d *schema.ResourceData) bool {
+	if strings.HasSuffix(k, ".%") || old == "" || new == "" {
+		return false
+	}
+	value, err := libratoSensitiveValue(new)
+	if err != nil {
+		return false
+	}
+	return old == libratoSensitiveHash(value)
+}
+
+func resourceLibratoServiceMergeSensitiveSettings(d *schema.ResourceData, service *librato.Service) error {
+	sensitiveSettings := d.Get("sensitive_settings").(map[string]interface{})
+	if len(sensitiveSettings) == 0 {
+		return nil
+	}
+
+	if service.Settings == nil {
+		service.Settings = make(map[string]interface{})
+	}
+	for k, v := range sensitiveSettings {
+		if _, ok := service.Settings[k]; ok {
+			return fmt.Errorf("Setting %q is set in both settings and sensitive_settings", k)
+		}
+		value, err := libratoSensitiveValue(v.(string))
+		if err != nil {
+			return fmt.Errorf("Error reading sensitive setting %q: %s", k, err)
+		}
+		service.Settings[k] = value
+	}
+
+	return nil
+}
+
+// Settings of every service type whose names suggest a secret, and the
+// secrets of particular types named otherwise.
+var (
+	libratoSensitiveSettingRegexp  = regexp.MustCompile(`(?i)(key|token|secret|password)`)
+	libratoSensitiveSettingsByType = map[string][]string{
+		"slack": {"url"},
+	}
+)
+
+// Returns whether settings read from Librato are sensitive. Keys in the state's
+// sensitive_settings are, and so are keys which look like secrets unless the
+// state keeps them in settings. Secrets of a service without a state, like one
+// being imported, thus never reach settings.
+func resourceLibratoServiceSensitiveKeys(d *schema.ResourceData, serviceType string) func(string) bool {
+	sensitiveKeys := d.Get("sensitive_settings").(map[string]interface{})
+	publicKeys, _ := resourceLibratoServicesExpandSettings(d.Get("settings").(string))
+
+	return func(k string) bool {
+		if _, ok := sensitiveKeys[k]; ok {
+			return true
+		}
+		if _, ok := publicKeys[k]; ok {
+			return false
+		}
+		if libratoSensitiveSettingRegexp.MatchString(k) {
+			return true
+		}
+		for _, typeKey := range libratoSensitiveSettingsByType[serviceType] {
+			if k == typeKey {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Returns a copy of the service for logging, without the sensitive settings
+func resourceLibratoServiceRedacted(d *schema.ResourceData, service *librato.Service) librato.Service {
+	redacted := *service
+	if service.Settings == nil {
+		return redacted
+	}
+
+	isSensitive := resourceLibratoServiceSensitiveKeys(d, stringValue(service.Type))
+	redacted.Settings = make(map[string]interface{}, len(service.Settings))
+	for k, v := range service.Settings {
+		if isSensitive(k) {
+			v = "<sensitive>"
+		}
+		redacted.Settings[k] = v
+	}
+	return redacted
+}
+
+// Finds the alerts notifying the service. With force_detach the service is
+// removed from them, otherwise they are listed in an error.
+func resourceLibratoServiceDetach(d *schema.ResourceData, client *librato.Client, id uint) error {
+	alerts, err := libratoListAlerts(client, "")
+	if err != nil {
+		return fmt.Errorf("Error listing Librato alerts using service %d: %s", id, err)
+	}
+
+	var using []librato.Alert
+	for _, alert := range alerts {
+		if _, ok := libratoAlertServiceIDs(alert)[id]; ok {
+			using = append(using, alert)
+		}
+	}
+	if len(using) == 0 {
+		return nil
+	}
+
+	if !d.Get("force_detach").(bool) {
+		names := make([]string, len(using))
+		for i, alert := range using {
+			names[i] = fmt.Sprintf("%s (%d)", *alert.Name, *alert.ID)
+		}
+		return fmt.Errorf("Librato service %d is still used by alerts %s. Remove it from them, "+
+			"or set force_detach = true to remove it when deleting the service", id, strings.Join(names, ", "))
+	}
+
+	for _, alert := range using {
+		services := make([]*string, 0)
+		for serviceID := range libratoAlertServiceIDs(alert) {
+			if serviceID != id {
+				services = append(services, librato.String(strconv.FormatUint(uint64(serviceID), 10)))
+			}
+		}
+
+		update := &librato.Alert{
+			Name:       alert.Name,
+			Conditions: alert.Conditions,
+			Services:   services,
+		}
+		log.Printf("[INFO] Detaching Librato Service %d from alert %d", id, *alert.ID)
+		if _, err := client.Alerts.Update(*alert.ID, update); err != nil {
+			return fmt.Errorf("Error detaching Librato service %d from alert %d: %s", id, *alert.ID, err)
+		}
+	}
+
+	return nil
+}
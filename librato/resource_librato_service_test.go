@@ -1,10 +1,15 @@
 package librato
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
 	"strconv"
 	"testing"
 
+	"github.com/hashicorp/terraform/helper/acctest"
 	"github.com/hashicorp/terraform/helper/resource"
 	"github.com/hashicorp/terraform/terraform"
 	"github.com/henrikhodne/go-librato/librato"
@@ -61,8 +66,233 @@ func TestAccLibratoService_Updated(t *testing.T) {
 	})
 }
 
+func TestAccLibratoService_ForceDetach(t *testing.T) {
+	var service librato.Service
+	var alert librato.Alert
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckLibratoServiceDetached(&alert),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccCheckLibratoServiceConfig_forceDetach(false),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckLibratoServiceExists("librato_service.foobar", &service),
+					testAccCreateLibratoAlertUsingService(&service, &alert),
+				),
+			},
+			{
+				Config:      testAccCheckLibratoServiceConfig_forceDetach(false),
+				Destroy:     true,
+				ExpectError: regexp.MustCompile("still used by alerts"),
+			},
+			{
+				Config: testAccCheckLibratoServiceConfig_forceDetach(true),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr(
+						"librato_service.foobar", "force_detach", "true"),
+				),
+			},
+		},
+	})
+}
+
+// Creates an alert outside of Terraform notifying the service
+func testAccCreateLibratoAlertUsingService(service *librato.Service, alert *librato.Alert) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		client := testAccProvider.Meta().(*Config).Client
+
+		created, _, err := client.Alerts.Create(&librato.Alert{
+			Name: librato.String(fmt.Sprintf("tftest-alert-%s", acctest.RandString(10))),
+			Conditions: []librato.AlertCondition{
+				{
+					Type:       librato.String("above"),
+					MetricName: librato.String("librato.cpu.percent.idle"),
+					Threshold:  librato.Float(10),
+				},
+			},
+			Services: []*string{librato.String(strconv.FormatUint(uint64(*service.ID), 10))},
+		})
+		if err != nil {
+			return err
+		}
+
+		*alert = *created
+		return nil
+	}
+}
+
+// Checks the service was removed from the alert, and cleans the alert up
+func testAccCheckLibratoServiceDetached(alert *librato.Alert) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		if err := testAccCheckLibratoServiceDestroy(s); err != nil {
+			return err
+		}
+
+		client := testAccProvider.Meta().(*Config).Client
+		found, _, err := client.Alerts.Get(*alert.ID)
+		if err != nil {
+			return err
+		}
+		if ids := libratoAlertServiceIDs(*found); len(ids) != 0 {
+			return fmt.Errorf("Alert still notifies services %v", ids)
+		}
+
+		_, err = client.Alerts.Delete(*alert.ID)
+		return err
+	}
+}
+
+func TestResourceLibratoServicesSettings(t *testing.T) {
+	raw := `{
+  "url": "https://hooks.example.com/librato",
+  "retries": 3,
+  "ratio": 1.50,
+  "verify_ssl": true,
+  "headers": {"X-Token": "secret", "Accept": "application/json"},
+  "channels": ["#ops", "#alerts"]
+}`
+
+	settings, err := resourceLibratoServicesExpandSettings(raw)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, ok := settings["retries"].(json.Number); !ok {
+		t.Fatalf("Expected retries to stay a number, got %#v", settings["retries"])
+	}
+	if _, ok := settings["verify_ssl"].(bool); !ok {
+		t.Fatalf("Expected verify_ssl to stay a boolean, got %#v", settings["verify_ssl"])
+	}
+	if _, ok := settings["headers"].(map[string]interface{}); !ok {
+		t.Fatalf("Expected headers to stay an object, got %#v", settings["headers"])
+	}
+
+	flattened, err := resourceLibratoServicesFlatten(settings)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if normalized := normalizeJSON(raw); flattened != normalized {
+		t.Fatalf("Settings read back differ from the configured ones:\n%s\n%s", flattened, normalized)
+	}
+
+	if _, es := validateLibratoServiceSettings(`["not", "an", "object"]`, "settings"); len(es) == 0 {
+		t.Fatalf("Expected settings that aren't an object to be invalid")
+	}
+}
+
+func TestResourceLibratoServicesSettings_numbers(t *testing.T) {
+	cases := []struct {
+		configured, read, normalized string
+	}{
+		{`{"id": 9007199254740993}`, `{"id": 9007199254740993}`, `{"id":9007199254740993}`},
+		{`{"id": 123456789012345678901234567890}`, `{"id": 123456789012345678901234567890}`, `{"id":123456789012345678901234567890}`},
+		{`{"ratio": 1.50}`, `{"ratio": 1.5}`, `{"ratio":1.5}`},
+		{`{"count": 1.0}`, `{"count": 1}`, `{"count":1}`},
+		{`{"limit": 1e3}`, `{"limit": 1000}`, `{"limit":1000}`},
+		{`{"nested": [{"n": 10.250}]}`, `{"nested": [{"n": 10.25}]}`, `{"nested":[{"n":10.25}]}`},
+	}
+	for _, c := range cases {
+		if normalized := normalizeJSON(c.configured); normalized != c.normalized {
+			t.Errorf("Bad normalized settings: %s, expected %s", normalized, c.normalized)
+		}
+
+		var service librato.Service
+		if err := json.Unmarshal([]byte(`{"settings": `+c.read+`}`), &service); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		flattened, err := resourceLibratoServicesFlatten(service.Settings)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if flattened != c.normalized {
+			t.Errorf("Bad settings read back: %s, expected %s", flattened, c.normalized)
+		}
+	}
+}
+
+func TestResourceLibratoServiceReadResult_sensitive(t *testing.T) {
+	service := &librato.Service{
+		ID:    librato.Uint(1),
+		Type:  librato.String("slack"),
+		Title: librato.String("Ops"),
+		Settings: map[string]interface{}{
+			"url":       "https://hooks.slack.com/services/T0/B0/secret",
+			"api_token": "secret",
+			"channel":   "#ops",
+			"password":  "kept",
+		},
+	}
+
+	// Without a state, like when importing, secrets are only kept as hashes
+	d := resourceLibratoService().TestResourceData()
+	if err := resourceLibratoServiceReadResult(d, &Config{}, service); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if settings := d.Get("settings").(string); settings != `{"channel":"#ops"}` {
+		t.Fatalf("Expected only the public settings, got: %s", settings)
+	}
+	sensitive := d.Get("sensitive_settings").(map[string]interface{})
+	if len(sensitive) != 3 || sensitive["url"] != libratoSensitiveHash("https://hooks.slack.com/services/T0/B0/secret") {
+		t.Fatalf("Bad sensitive settings: %v", sensitive)
+	}
+
+	// Settings configured as public stay public
+	d = resourceLibratoService().TestResourceData()
+	d.Set("settings", `{"channel": "#ops", "password": "kept"}`)
+	if err := resourceLibratoServiceReadResult(d, &Config{}, service); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if settings := d.Get("settings").(string); settings != `{"channel":"#ops","password":"kept"}` {
+		t.Fatalf("Expected the configured settings to stay public, got: %s", settings)
+	}
+	if redacted := resourceLibratoServiceRedacted(d, service); redacted.Settings["api_token"] != "<sensitive>" || redacted.Settings["password"] != "kept" {
+		t.Fatalf("Bad redacted settings: %v", redacted.Settings)
+	}
+}
+
+func TestLibratoSensitiveValue(t *testing.T) {
+	os.Setenv("TF_LIBRATO_TEST_SECRET", "from-env")
+	defer os.Unsetenv("TF_LIBRATO_TEST_SECRET")
+
+	f, err := ioutil.TempFile("", "librato-secret")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("from-file\n")
+	f.Close()
+
+	cases := map[string]string{
+		"literal":                    "literal",
+		"env:TF_LIBRATO_TEST_SECRET": "from-env",
+		"file:" + f.Name():           "from-file",
+	}
+	for in, expected := range cases {
+		value, err := libratoSensitiveValue(in)
+		if err != nil {
+			t.Fatalf("%s: err: %s", in, err)
+		}
+		if value != expected {
+			t.Fatalf("%s: expected %q, got %q", in, expected, value)
+		}
+	}
+
+	if _, err := libratoSensitiveValue("env:TF_LIBRATO_TEST_UNSET"); err == nil {
+		t.Fatalf("Expected an unset environment variable to fail")
+	}
+
+	hash := libratoSensitiveHash("from-env")
+	if !suppressLibratoSensitiveSettingDiff("sensitive_settings.token", hash, "env:TF_LIBRATO_TEST_SECRET", nil) {
+		t.Fatalf("Expected the diff of an unchanged secret to be suppressed")
+	}
+	if suppressLibratoSensitiveSettingDiff("sensitive_settings.token", hash, "rotated", nil) {
+		t.Fatalf("Expected the diff of a changed secret to be kept")
+	}
+}
+
 func testAccCheckLibratoServiceDestroy(s *terraform.State) error {
-	client := testAccProvider.Meta().(*librato.Client)
+	client := testAccProvider.Meta().(*Config).Client
 
 	for _, rs := range s.RootModule().Resources {
 		if rs.Type != "librato_service" {
@@ -107,7 +337,7 @@ func testAccCheckLibratoServiceExists(n string, service *librato.Service) resour
 			return fmt.Errorf("No Service ID is set")
 		}
 
-		client := testAccProvider.Meta().(*librato.Client)
+		client := testAccProvider.Meta().(*Config).Client
 
 		id, err := strconv.ParseUint(rs.Primary.ID, 10, 0)
 		if err != nil {
@@ -151,3 +381,17 @@ resource "librato_service" "foobar" {
 }
 EOF
 }`
+
+func testAccCheckLibratoServiceConfig_forceDetach(forceDetach bool) string {
+	return fmt.Sprintf(`
+resource "librato_service" "foobar" {
+    title = "Foo Bar"
+    type = "mail"
+    force_detach = %t
+    settings = <<EOF
+{
+  "addresses": "admin@example.com"
+}
+EOF
+}`, forceDetach)
+}
@@ -0,0 +1,600 @@
+package librato
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/henrikhodne/go-librato/librato"
+)
+
+func resourceLibratoSLO() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceLibratoSLOCreate,
+		Read:   resourceLibratoSLORead,
+		Update: resourceLibratoSLOUpdate,
+		Delete: resourceLibratoSLODelete,
+
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Type:         schema.TypeString,
+				Required:     true,
+				ForceNew:     true,
+				ValidateFunc: validateLibratoSLOName,
+			},
+			"good_metric": {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+			"total_metric": {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+			"source": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Default:  "*",
+			},
+			// Filters the series on the appoptics backend, which doesn't
+			// know sources
+			"tags": {
+				Type:     schema.TypeMap,
+				Optional: true,
+			},
+			"target": {
+				Type:         schema.TypeFloat,
+				Required:     true,
+				ValidateFunc: validateLibratoSLOTarget,
+			},
+			"fast_burn_rate": {
+				Type:     schema.TypeFloat,
+				Optional: true,
+				Default:  14.4,
+			},
+			"fast_burn_long_window": {
+				Type:     schema.TypeInt,
+				Optional: true,
+				Default:  3600,
+			},
+			"fast_burn_short_window": {
+				Type:     schema.TypeInt,
+				Optional: true,
+				Default:  300,
+			},
+			"slow_burn_rate": {
+				Type:     schema.TypeFloat,
+				Optional: true,
+				Default:  6,
+			},
+			"slow_burn_long_window": {
+				Type:     schema.TypeInt,
+				Optional: true,
+				Default:  21600,
+			},
+			"slow_burn_short_window": {
+				Type:     schema.TypeInt,
+				Optional: true,
+				Default:  1800,
+			},
+			"services": {
+				Type:     schema.TypeSet,
+				Optional: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+				Set:      schema.HashString,
+			},
+			"create_space": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+			"metric_names": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+			"fast_burn_alert_id": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"slow_burn_alert_id": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"space_id": {
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+			"chart_id": {
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+			// The alerts and chart that were deleted outside of Terraform.
+			// Refreshes set it, and as it's never configured the next plan
+			// updates the SLO to unset it, which creates them again.
+			"missing_objects": {
+				Type:     schema.TypeSet,
+				Optional: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+				Set:      schema.HashString,
+			},
+		},
+	}
+}
+
+func validateLibratoSLOName(v interface{}, k string) (ws []string, es []error) {
+	if !regexp.MustCompile(`^[A-Za-z0-9.:_-]+$`).MatchString(v.(string)) {
+		es = append(es, fmt.Errorf("%q may only contain letters, digits, '.', ':', '-' and '_'", k))
+	}
+	return
+}
+
+func validateLibratoSLOTarget(v interface{}, k string) (ws []string, es []error) {
+	if t := v.(float64); t <= 0 || t >= 1 {
+		es = append(es, fmt.Errorf("%q must be between 0 and 1 (exclusive), got %f", k, t))
+	}
+	return
+}
+
+// A burn rate alert pairs a long window, which makes sure enough of the error
+// budget has been spent, with a short window, which makes the alert reset
+// quickly once the errors stop.
+type libratoSLOBurn struct {
+	key         string
+	rate        float64
+	longWindow  int
+	shortWindow int
+}
+
+func resourceLibratoSLOBurns(d *schema.ResourceData) []libratoSLOBurn {
+	return []libratoSLOBurn{
+		{
+			key:         "fast_burn",
+			rate:        d.Get("fast_burn_rate").(float64),
+			longWindow:  d.Get("fast_burn_long_window").(int),
+			shortWindow: d.Get("fast_burn_short_window").(int),
+		},
+		{
+			key:         "slow_burn",
+			rate:        d.Get("slow_burn_rate").(float64),
+			longWindow:  d.Get("slow_burn_long_window").(int),
+			shortWindow: d.Get("slow_burn_short_window").(int),
+		},
+	}
+}
+
+// Returns the error ratio above which the error budget of a target burns
+// faster than rate.
+func libratoSLOBurnThreshold(rate, target float64) float64 {
+	return rate * (1 - target)
+}
+
+func libratoSLOMetricName(name string, window int) string {
+	return fmt.Sprintf("%s.error_ratio.%ds", name, window)
+}
+
+// Builds the composite expression for the ratio of bad to total events over
+// the given window, in seconds. The filter is the second argument of the
+// series, see resourceLibratoSLOSeriesFilter.
+func libratoSLOErrorRatioComposite(good, total, filter string, window int) string {
+	return fmt.Sprintf(
+		`divide([window(subtract([sum(s("%[2]s", %[3]s)), sum(s("%[1]s", %[3]s))]), {function: "sum", size: "%[4]d"}), window(sum(s("%[2]s", %[3]s)), {function: "sum", size: "%[4]d"})])`,
+		good, total, filter, window)
+}
+
+// Returns the filter of the good and total series in composites: the source
+// on the librato backend, and the tags on the appoptics backend, where no tags
+// select every series.
+func resourceLibratoSLOSeriesFilter(config *Config, d *schema.ResourceData) string {
+	if config.Backend != libratoBackendAppOptics {
+		return fmt.Sprintf(`"%s"`, d.Get("source").(string))
+	}
+
+	tags := d.Get("tags").(map[string]interface{})
+	names := make([]string, 0, len(tags))
+	for name := range tags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	filters := make([]string, len(names))
+	for i, name := range names {
+		filters[i] = fmt.Sprintf(`"%s": "%s"`, name, tags[name])
+	}
+	return "{" + strings.Join(filters, ", ") + "}"
+}
+
+// Returns the windows that need an error ratio metric, without duplicates.
+func resourceLibratoSLOWindows(d *schema.ResourceData) []int {
+	var windows []int
+	seen := make(map[int]bool)
+	for _, b := range resourceLibratoSLOBurns(d) {
+		for _, w := range []int{b.longWindow, b.shortWindow} {
+			if !seen[w] {
+				seen[w] = true
+				windows = append(windows, w)
+			}
+		}
+	}
+	return windows
+}
+
+func resourceLibratoSLOExpandAlert(config *Config, d *schema.ResourceData, b libratoSLOBurn) *librato.Alert {
+	name := d.Get("name").(string)
+	threshold := libratoSLOBurnThreshold(b.rate, d.Get("target").(float64))
+
+	alert := &librato.Alert{
+		Name: librato.String(config.affixName(fmt.Sprintf("%s.%s", name, b.key))),
+		Description: librato.String(fmt.Sprintf(
+			"Error budget of %s burning at %gx over %ds and %ds",
+			name, b.rate, b.longWindow, b.shortWindow)),
+		Active: librato.Bool(true),
+	}
+
+	// Conditions of an alert must all be met for it to fire. Both have to hold
+	// for the short window, so that a single spike doesn't fire the alert.
+	for _, w := range []int{b.longWindow, b.shortWindow} {
+		condition := librato.AlertCondition{
+			Type:       librato.String("above"),
+			MetricName: librato.String(config.affixMetricName(libratoSLOMetricName(name, w))),
+			Threshold:  librato.Float(threshold),
+			Duration:   librato.Uint(uint(b.shortWindow)),
+		}
+		// The ratio metrics are already filtered, and their single series has
+		// no tags to filter on with the appoptics backend
+		if config.Backend != libratoBackendAppOptics {
+			condition.Source = librato.String("*")
+		}
+		alert.Conditions = append(alert.Conditions, condition)
+	}
+
+	vs := d.Get("services").(*schema.Set)
+	services := make([]*string, vs.Len())
+	for i, serviceData := range vs.List() {
+		services[i] = librato.String(serviceData.(string))
+	}
+	alert.Services = services
+
+	return alert
+}
+
+func resourceLibratoSLOExpandChart(config *Config, d *schema.ResourceData) *librato.SpaceChart {
+	name := d.Get("name").(string)
+	budget := 1 - d.Get("target").(float64)
+
+	chart := &librato.SpaceChart{
+		Name: librato.String(config.affixName(fmt.Sprintf("%s error budget burn rate", name))),
+		Type: librato.String("line"),
+	}
+	for _, b := range resourceLibratoSLOBurns(d) {
+		ratio := libratoSLOErrorRatioComposite(
+			config.affixMetricName(d.Get("good_metric").(string)),
+			config.affixMetricName(d.Get("total_metric").(string)),
+			resourceLibratoSLOSeriesFilter(config, d),
+			b.longWindow)
+		chart.Streams = append(chart.Streams, librato.SpaceChartStream{
+			Name:      librato.String(fmt.Sprintf("burn rate over %ds", b.longWindow)),
+			Composite: librato.String(fmt.Sprintf(`scale(%s, {factor: "%g"})`, ratio, 1/budget)),
+		})
+	}
+
+	return chart
+}
+
+// Puts the error ratio metrics. Their names are kept in the state without the
+// provider's name affixes, like the names of librato_metric resources.
+func resourceLibratoSLOPutMetrics(config *Config, d *schema.ResourceData) error {
+	client := config.Client
+	name := d.Get("name").(string)
+
+	var metricNames []string
+	for _, w := range resourceLibratoSLOWindows(d) {
+		metricName := libratoSLOMetricName(name, w)
+		metric := &librato.Metric{
+			Name:        librato.String(config.affixMetricName(metricName)),
+			Type:        librato.String("composite"),
+			DisplayName: librato.String(fmt.Sprintf("%s error ratio (%ds)", name, w)),
+			Composite: librato.String(libratoSLOErrorRatioComposite(
+				config.affixMetricName(d.Get("good_metric").(string)),
+				config.affixMetricName(d.Get("total_metric").(string)),
+				resourceLibratoSLOSeriesFilter(config, d),
+				w)),
+		}
+
+		log.Printf("[INFO] Updating Librato metric: %v", structToString(metric))
+		if _, err := client.Metrics.Update(metric); err != nil {
+			return fmt.Errorf("Error updating Librato metric %s: %s", *metric.Name, err)
+		}
+		metricNames = append(metricNames, metricName)
+	}
+
+	return d.Set("metric_names", metricNames)
+}
+
+func resourceLibratoSLOCreate(d *schema.ResourceData, meta interface{}) error {
+	config := meta.(*Config)
+
+	if err := config.checkBackend("librato_slo", d); err != nil {
+		return err
+	}
+	if _, ok := d.GetOk("tags"); ok && config.Backend != libratoBackendAppOptics {
+		return fmt.Errorf("librato_slo %q: tags are only supported by the appoptics backend, filter with source instead", d.Get("name").(string))
+	}
+	for _, b := range resourceLibratoSLOBurns(d) {
+		if err := config.checkAlertPolicy(resourceLibratoSLOExpandAlert(config, d, b)); err != nil {
+			return err
+		}
+	}
+
+	d.SetId(d.Get("name").(string))
+
+	if err := resourceLibratoSLOCreateObjects(config, d); err != nil {
+		// Remove what was created so far. Should that fail too, the SLO is
+		// kept in the state to be replaced, which removes the rest.
+		var metricNames []string
+		for _, w := range resourceLibratoSLOWindows(d) {
+			metricNames = append(metricNames, libratoSLOMetricName(d.Get("name").(string), w))
+		}
+		d.Set("metric_names", metricNames)
+		if deleteErr := resourceLibratoSLODelete(d, meta); deleteErr != nil {
+			log.Printf("[WARN] Error removing the objects of failed Librato SLO %s: %s", d.Id(), deleteErr)
+		}
+		return err
+	}
+
+	return resourceLibratoSLORead(d, meta)
+}
+
+func resourceLibratoSLOCreateObjects(config *Config, d *schema.ResourceData) error {
+	if err := resourceLibratoSLOPutMetrics(config, d); err != nil {
+		return err
+	}
+
+	for _, b := range resourceLibratoSLOBurns(d) {
+		if err := resourceLibratoSLOCreateAlert(config, d, b); err != nil {
+			return err
+		}
+	}
+
+	if d.Get("create_space").(bool) {
+		return resourceLibratoSLOCreateSpace(config, d)
+	}
+	return nil
+}
+
+func resourceLibratoSLOCreateAlert(config *Config, d *schema.ResourceData, b libratoSLOBurn) error {
+	alert := resourceLibratoSLOExpandAlert(config, d, b)
+	alertResult, _, err := config.Client.Alerts.Create(alert)
+	if err != nil {
+		return fmt.Errorf("Error creating Librato alert %s: %s", *alert.Name, err)
+	}
+	log.Printf("[INFO] Created Librato alert: %s", *alertResult)
+	d.Set(fmt.Sprintf("%s_alert_id", b.key), strconv.FormatUint(uint64(*alertResult.ID), 10))
+
+	return nil
+}
+
+func resourceLibratoSLOCreateSpace(config *Config, d *schema.ResourceData) error {
+	client := config.Client
+	spaceID := uint(d.Get("space_id").(int))
+	if spaceID == 0 {
+		name := config.affixName(fmt.Sprintf("%s SLO", d.Get("name").(string)))
+		space, _, err := client.Spaces.Create(&librato.Space{Name: librato.String(name)})
+		if err != nil {
+			return fmt.Errorf("Error creating Librato space %s: %s", name, err)
+		}
+		spaceID = *space.ID
+		d.Set("space_id", int(spaceID))
+	}
+
+	chart := resourceLibratoSLOExpandChart(config, d)
+	chartResult, _, err := client.Spaces.CreateChart(spaceID, chart)
+	if err != nil {
+		return fmt.Errorf("Error creating Librato space chart %s: %s", *chart.Name, err)
+	}
+	d.Set("chart_id", int(*chartResult.ID))
+
+	return nil
+}
+
+// Objects deleted outside of Terraform are cleared from the state and listed
+// in missing_objects, so that the next apply only creates those again.
+func resourceLibratoSLORead(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*Config).Client
+
+	missing := schema.NewSet(schema.HashString, nil)
+	for _, b := range resourceLibratoSLOBurns(d) {
+		key := fmt.Sprintf("%s_alert_id", b.key)
+		rawID := d.Get(key).(string)
+		if rawID == "" {
+			log.Printf("[WARN] Librato SLO %s has no %s alert", d.Id(), b.key)
+			missing.Add(b.key + "_alert")
+			continue
+		}
+		id, err := strconv.ParseUint(rawID, 10, 0)
+		if err != nil {
+			return err
+		}
+
+		log.Printf("[INFO] Reading Librato Alert: %d", id)
+		if _, _, err := client.Alerts.Get(uint(id)); err != nil {
+			if librato.IsNotFound(err) {
+				log.Printf("[WARN] Librato Alert %d of SLO %s not found", id, d.Id())
+				d.Set(key, "")
+				missing.Add(b.key + "_alert")
+				continue
+			}
+			return fmt.Errorf("Error reading Librato Alert %d: %s", id, err)
+		}
+	}
+
+	if spaceID := d.Get("space_id").(int); spaceID != 0 {
+		chartID := d.Get("chart_id").(int)
+		if _, _, err := client.Spaces.GetChart(uint(spaceID), uint(chartID)); err != nil {
+			if !librato.IsNotFound(err) {
+				return fmt.Errorf("Error reading Librato Space chart %d: %s", chartID, err)
+			}
+			log.Printf("[WARN] Librato Space chart %d/%d of SLO %s not found", spaceID, chartID, d.Id())
+			if _, _, err := client.Spaces.Get(uint(spaceID)); err != nil {
+				d.Set("space_id", 0)
+			}
+			d.Set("chart_id", 0)
+			missing.Add("chart")
+		}
+	}
+
+	return d.Set("missing_objects", missing)
+}
+
+func resourceLibratoSLOUpdate(d *schema.ResourceData, meta interface{}) error {
+	config := meta.(*Config)
+	client := config.Client
+
+	if err := config.checkBackend("librato_slo", d); err != nil {
+		return err
+	}
+	if _, ok := d.GetOk("tags"); ok && config.Backend != libratoBackendAppOptics {
+		return fmt.Errorf("librato_slo %q: tags are only supported by the appoptics backend, filter with source instead", d.Get("name").(string))
+	}
+	for _, b := range resourceLibratoSLOBurns(d) {
+		if err := config.checkAlertPolicy(resourceLibratoSLOExpandAlert(config, d, b)); err != nil {
+			return err
+		}
+	}
+
+	oldMetricNames := d.Get("metric_names").([]interface{})
+	if err := resourceLibratoSLOPutMetrics(config, d); err != nil {
+		return err
+	}
+
+	// Remove the ratio metrics of windows that are no longer used
+	newMetricNames := make(map[string]bool)
+	for _, n := range d.Get("metric_names").([]interface{}) {
+		newMetricNames[n.(string)] = true
+	}
+	for _, n := range oldMetricNames {
+		if !newMetricNames[n.(string)] {
+			name := config.affixMetricName(n.(string))
+			log.Printf("[INFO] Deleting Metric: %s", name)
+			if _, err := client.Metrics.Delete(name); err != nil {
+				return fmt.Errorf("Error deleting Metric: %s", err)
+			}
+		}
+	}
+
+	for _, b := range resourceLibratoSLOBurns(d) {
+		rawID := d.Get(fmt.Sprintf("%s_alert_id", b.key)).(string)
+		if rawID == "" {
+			if err := resourceLibratoSLOCreateAlert(config, d, b); err != nil {
+				return err
+			}
+			continue
+		}
+		id, err := strconv.ParseUint(rawID, 10, 0)
+		if err != nil {
+			return err
+		}
+
+		alert := resourceLibratoSLOExpandAlert(config, d, b)
+		log.Printf("[INFO] Updating Librato alert: %s", alert)
+		if _, err := client.Alerts.Update(uint(id), alert); err != nil {
+			return fmt.Errorf("Error updating Librato alert: %s", err)
+		}
+	}
+
+	spaceID := uint(d.Get("space_id").(int))
+	chartID := uint(d.Get("chart_id").(int))
+	switch {
+	case d.Get("create_space").(bool) && chartID == 0:
+		if err := resourceLibratoSLOCreateSpace(config, d); err != nil {
+			return err
+		}
+	case !d.Get("create_space").(bool) && spaceID != 0:
+		if err := resourceLibratoSLODeleteSpace(d, client); err != nil {
+			return err
+		}
+	case spaceID != 0:
+		chart := resourceLibratoSLOExpandChart(config, d)
+		if _, err := client.Spaces.UpdateChart(spaceID, chartID, chart); err != nil {
+			return fmt.Errorf("Error updating Librato space chart %s: %s", *chart.Name, err)
+		}
+	}
+
+	return resourceLibratoSLORead(d, meta)
+}
+
+func resourceLibratoSLODeleteSpace(d *schema.ResourceData, client *librato.Client) error {
+	spaceID := uint(d.Get("space_id").(int))
+
+	log.Printf("[INFO] Deleting Space: %d", spaceID)
+	if _, err := client.Spaces.Delete(spaceID); err != nil {
+		if !librato.IsNotFound(err) {
+			return fmt.Errorf("Error deleting space: %s", err)
+		}
+	}
+	d.Set("space_id", 0)
+	d.Set("chart_id", 0)
+
+	return nil
+}
+
+func resourceLibratoSLODelete(d *schema.ResourceData, meta interface{}) error {
+	config := meta.(*Config)
+	client := config.Client
+
+	if d.Get("space_id").(int) != 0 {
+		if err := resourceLibratoSLODeleteSpace(d, client); err != nil {
+			return err
+		}
+	}
+
+	for _, b := range resourceLibratoSLOBurns(d) {
+		rawID := d.Get(fmt.Sprintf("%s_alert_id", b.key)).(string)
+		if rawID == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(rawID, 10, 0)
+		if err != nil {
+			return err
+		}
+
+		log.Printf("[INFO] Deleting Alert: %d", id)
+		if _, err := client.Alerts.Delete(uint(id)); err != nil {
+			if !librato.IsNotFound(err) {
+				return fmt.Errorf("Error deleting Alert: %s", err)
+			}
+		}
+	}
+
+	// Composite metrics hold no measurements, so removing them loses no data
+	for _, n := range d.Get("metric_names").([]interface{}) {
+		name := config.affixMetricName(n.(string))
+		log.Printf("[INFO] Deleting Metric: %s", name)
+		if _, err := client.Metrics.Delete(name); err != nil {
+			if !librato.IsNotFound(err) {
+				return fmt.Errorf("Error deleting Metric: %s", err)
+			}
+		}
+
+		retryErr := resource.Retry(1*time.Minute, func() *resource.RetryError {
+			_, _, err := client.Metrics.Get(name)
+			if err != nil {
+				if librato.IsNotFound(err) {
+					return nil
+				}
+				return resource.NonRetryableError(err)
+			}
+			return resource.RetryableError(fmt.Errorf("metric still exists"))
+		})
+		if retryErr != nil {
+			return fmt.Errorf("Error deleting librato metric: %s", retryErr)
+		}
+	}
+
+	d.SetId("")
+	return nil
+}
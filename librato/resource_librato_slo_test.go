@@ -0,0 +1,436 @@
+package librato
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/acctest"
+	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/henrikhodne/go-librato/librato"
+)
+
+func TestAccLibratoSLO_Basic(t *testing.T) {
+	var fast, slow librato.Alert
+	name := fmt.Sprintf("tftest-slo-%s", acctest.RandString(10))
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckLibratoSLODestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccCheckLibratoSLOConfig_basic(name, "0.999", false),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckLibratoSLOAlertExists("librato_slo.foobar", "fast_burn_alert_id", &fast),
+					testAccCheckLibratoAlertName(&fast, fmt.Sprintf("%s.fast_burn", name)),
+					testAccCheckLibratoSLOThreshold(&fast, 0.0144),
+					testAccCheckLibratoSLOAlertExists("librato_slo.foobar", "slow_burn_alert_id", &slow),
+					testAccCheckLibratoAlertName(&slow, fmt.Sprintf("%s.slow_burn", name)),
+					testAccCheckLibratoSLOThreshold(&slow, 0.006),
+					resource.TestCheckResourceAttr(
+						"librato_slo.foobar", "metric_names.#", "4"),
+					resource.TestCheckResourceAttr(
+						"librato_slo.foobar", "metric_names.0", fmt.Sprintf("%s.error_ratio.3600s", name)),
+					resource.TestCheckResourceAttr(
+						"librato_slo.foobar", "space_id", "0"),
+				),
+			},
+			{
+				Config: testAccCheckLibratoSLOConfig_basic(name, "0.99", true),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckLibratoSLOAlertExists("librato_slo.foobar", "fast_burn_alert_id", &fast),
+					testAccCheckLibratoSLOThreshold(&fast, 0.144),
+					resource.TestCheckResourceAttrSet(
+						"librato_slo.foobar", "space_id"),
+					resource.TestCheckResourceAttrSet(
+						"librato_slo.foobar", "chart_id"),
+				),
+			},
+		},
+	})
+}
+
+func TestLibratoSLOBurnThreshold(t *testing.T) {
+	cases := []struct {
+		rate, target, threshold float64
+	}{
+		{14.4, 0.999, 0.0144},
+		{6, 0.999, 0.006},
+		{14.4, 0.99, 0.144},
+		{1, 0.9, 0.1},
+		{2, 0.5, 1},
+	}
+	for _, c := range cases {
+		if threshold := libratoSLOBurnThreshold(c.rate, c.target); math.Abs(threshold-c.threshold) > 1e-9 {
+			t.Errorf("Bad threshold for rate %g and target %g: %g, expected %g", c.rate, c.target, threshold, c.threshold)
+		}
+	}
+}
+
+func TestLibratoSLOErrorRatioComposite(t *testing.T) {
+	cases := []struct {
+		good, total, filter string
+		window              int
+		composite           string
+	}{
+		{
+			"api.good", "api.total", `"*"`, 300,
+			`divide([window(subtract([sum(s("api.total", "*")), sum(s("api.good", "*"))]), {function: "sum", size: "300"}), window(sum(s("api.total", "*")), {function: "sum", size: "300"})])`,
+		},
+		{
+			"web.ok", "web.all", `"web-*"`, 21600,
+			`divide([window(subtract([sum(s("web.all", "web-*")), sum(s("web.ok", "web-*"))]), {function: "sum", size: "21600"}), window(sum(s("web.all", "web-*")), {function: "sum", size: "21600"})])`,
+		},
+		{
+			"api.good", "api.total", `{"region": "us-*"}`, 300,
+			`divide([window(subtract([sum(s("api.total", {"region": "us-*"})), sum(s("api.good", {"region": "us-*"}))]), {function: "sum", size: "300"}), window(sum(s("api.total", {"region": "us-*"})), {function: "sum", size: "300"})])`,
+		},
+	}
+	for _, c := range cases {
+		if composite := libratoSLOErrorRatioComposite(c.good, c.total, c.filter, c.window); composite != c.composite {
+			t.Errorf("Bad composite:\n%s\nexpected:\n%s", composite, c.composite)
+		}
+		if !compositeReferencesMetric(c.composite, c.good) || !compositeReferencesMetric(c.composite, c.total) {
+			t.Errorf("Expected %s to reference %s and %s", c.composite, c.good, c.total)
+		}
+	}
+}
+
+func TestResourceLibratoSLOExpandAlert(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, resourceLibratoSLO().Schema, map[string]interface{}{
+		"name":         "api",
+		"good_metric":  "api.requests.good",
+		"total_metric": "api.requests.total",
+		"target":       0.999,
+	})
+	cases := map[string]struct {
+		windows   []string
+		duration  uint
+		threshold float64
+	}{
+		"fast_burn": {[]string{"api.error_ratio.3600s", "api.error_ratio.300s"}, 300, 0.0144},
+		"slow_burn": {[]string{"api.error_ratio.21600s", "api.error_ratio.1800s"}, 1800, 0.006},
+	}
+	for _, b := range resourceLibratoSLOBurns(d) {
+		c := cases[b.key]
+		alert := resourceLibratoSLOExpandAlert(&Config{}, d, b)
+		if len(alert.Conditions) != len(c.windows) {
+			t.Fatalf("Bad %s conditions: %v", b.key, alert.Conditions)
+		}
+		for i, condition := range alert.Conditions {
+			if *condition.MetricName != c.windows[i] {
+				t.Errorf("Bad %s condition metric: %s", b.key, *condition.MetricName)
+			}
+			if condition.Duration == nil || *condition.Duration != c.duration {
+				t.Errorf("Bad %s condition duration: %v", b.key, condition.Duration)
+			}
+			if math.Abs(*condition.Threshold-c.threshold) > 1e-9 {
+				t.Errorf("Bad %s condition threshold: %g", b.key, *condition.Threshold)
+			}
+		}
+	}
+}
+
+func TestLibratoSLO_nameAffixes(t *testing.T) {
+	api, server := newFakeLibratoAPI()
+	defer server.Close()
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers:    testFakeLibratoProviders(server),
+		CheckDestroy: testCheckFakeLibratoAPIEmpty(api),
+		Steps: []resource.TestStep{
+			{
+				Config: testLibratoSLOConfig_nameAffixes,
+				Check: resource.ComposeTestCheckFunc(
+					testCheckFakeLibratoAPINames(api, "alerts", "dev-api.fast_burn", "dev-api.slow_burn"),
+					testCheckFakeLibratoAPINames(api, "metrics",
+						"dev-api.error_ratio.300s", "dev-api.error_ratio.3600s",
+						"dev-api.error_ratio.1800s", "dev-api.error_ratio.21600s"),
+					testCheckFakeLibratoAPINames(api, "spaces", "dev-api SLO"),
+					testCheckFakeLibratoAPINames(api, "charts", "dev-api error budget burn rate"),
+					resource.TestCheckResourceAttr(
+						"librato_slo.foobar", "metric_names.0", "api.error_ratio.3600s"),
+					func(s *terraform.State) error {
+						api.mu.Lock()
+						defer api.mu.Unlock()
+						for k, object := range api.objects {
+							composite, _ := object["composite"].(string)
+							if strings.HasPrefix(k, "metrics/") && !strings.Contains(composite, `s("dev-api.requests.total", "*")`) {
+								return fmt.Errorf("Bad composite of %s: %s", k, composite)
+							}
+						}
+						return nil
+					},
+				),
+			},
+		},
+	})
+}
+
+const testLibratoSLOConfig_nameAffixes = `
+provider "librato" {
+    email = "test@example.com"
+    token = "test"
+    name_prefix = "dev-"
+    affix_metric_names = true
+}
+
+resource "librato_slo" "foobar" {
+    name = "api"
+    good_metric = "api.requests.good"
+    total_metric = "api.requests.total"
+    target = 0.999
+    create_space = true
+}`
+
+// On the appoptics backend the default source is no filter, and the series are
+// filtered by tags instead.
+func TestLibratoSLO_appOptics(t *testing.T) {
+	api, server := newFakeLibratoAPI()
+	defer server.Close()
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers:    testFakeLibratoProviders(server),
+		CheckDestroy: testCheckFakeLibratoAPIEmpty(api),
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(testLibratoSLOConfig_appOptics, ""),
+				Check: resource.ComposeTestCheckFunc(
+					testCheckFakeLibratoAPINames(api, "alerts", "api.fast_burn", "api.slow_burn"),
+					testCheckFakeLibratoAPINames(api, "charts", "api error budget burn rate"),
+					func(s *terraform.State) error {
+						api.mu.Lock()
+						defer api.mu.Unlock()
+						for k, object := range api.objects {
+							switch {
+							case strings.HasPrefix(k, "metrics/"):
+								if composite := object["composite"].(string); !strings.Contains(composite, `s("api.requests.total", {"region": "us-*"})`) {
+									return fmt.Errorf("Bad composite of %s: %s", k, composite)
+								}
+							case strings.HasPrefix(k, "alerts/"):
+								for _, c := range object["conditions"].([]interface{}) {
+									if source, ok := c.(map[string]interface{})["source"]; ok {
+										return fmt.Errorf("Bad condition source of %s: %v", k, source)
+									}
+								}
+							}
+						}
+						return nil
+					},
+				),
+			},
+			{
+				Config:      fmt.Sprintf(testLibratoSLOConfig_appOptics, `source = "web-*"`),
+				ExpectError: regexp.MustCompile("source isn't supported by the appoptics backend"),
+			},
+		},
+	})
+}
+
+const testLibratoSLOConfig_appOptics = `
+provider "librato" {
+    token = "test"
+    backend = "appoptics"
+}
+
+resource "librato_slo" "foobar" {
+    name = "api"
+    good_metric = "api.requests.good"
+    total_metric = "api.requests.total"
+    target = 0.999
+    create_space = true
+    tags {
+      region = "us-*"
+    }
+    %s
+}`
+
+// Alerts and charts deleted outside of Terraform are created again on the next
+// apply, leaving the rest of the SLO in place.
+func TestLibratoSLO_missingObjects(t *testing.T) {
+	api, server := newFakeLibratoAPI()
+	defer server.Close()
+
+	posts := make(map[string]int)
+	created := func(collection string, expected int) resource.TestCheckFunc {
+		return func(s *terraform.State) error {
+			api.mu.Lock()
+			defer api.mu.Unlock()
+			n := 0
+			for _, r := range api.requests {
+				if strings.HasPrefix(r, "POST ") && strings.HasSuffix(r, collection) {
+					n++
+				}
+			}
+			if n-posts[collection] != expected {
+				return fmt.Errorf("Expected %d %s created, got %d", expected, collection, n-posts[collection])
+			}
+			posts[collection] = n
+			return nil
+		}
+	}
+	config := testFakeLibratoProviderConfig + testLibratoSLOConfig_missingObjects
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers:    testFakeLibratoProviders(server),
+		CheckDestroy: testCheckFakeLibratoAPIEmpty(api),
+		Steps: []resource.TestStep{
+			{
+				Config: config,
+				Check: resource.ComposeTestCheckFunc(
+					created("alerts", 2),
+					created("spaces", 1),
+					created("charts", 1),
+				),
+			},
+			{
+				PreConfig: func() {
+					api.mu.Lock()
+					defer api.mu.Unlock()
+					for k, object := range api.objects {
+						if object["name"] == "api.slow_burn" || strings.Contains(k, "/charts/") {
+							delete(api.objects, k)
+						}
+					}
+				},
+				Config: config,
+				Check: resource.ComposeTestCheckFunc(
+					testCheckFakeLibratoAPINames(api, "alerts", "api.fast_burn", "api.slow_burn"),
+					testCheckFakeLibratoAPINames(api, "charts", "api error budget burn rate"),
+					created("alerts", 1),
+					created("spaces", 0),
+					created("charts", 1),
+					resource.TestCheckResourceAttr("librato_slo.foobar", "create_space", "true"),
+					resource.TestCheckResourceAttr("librato_slo.foobar", "missing_objects.#", "0"),
+				),
+			},
+		},
+	})
+}
+
+// A failed create removes the objects it created before failing.
+func TestLibratoSLO_createFailure(t *testing.T) {
+	api, server := newFakeLibratoAPI()
+	defer server.Close()
+	api.reject("POST", "charts", map[string]interface{}{"name": []string{"is invalid"}})
+
+	config := testFakeLibratoProviderConfig + testLibratoSLOConfig_missingObjects
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers:    testFakeLibratoProviders(server),
+		CheckDestroy: testCheckFakeLibratoAPIEmpty(api),
+		Steps: []resource.TestStep{
+			{
+				Config:      config,
+				ExpectError: regexp.MustCompile("Error creating Librato space chart"),
+			},
+			{
+				PreConfig: func() {
+					if err := testCheckFakeLibratoAPIEmpty(api)(nil); err != nil {
+						t.Fatal(err)
+					}
+					api.mu.Lock()
+					defer api.mu.Unlock()
+					delete(api.rejections, "POST charts")
+				},
+				Config: config,
+				Check: resource.ComposeTestCheckFunc(
+					testCheckFakeLibratoAPINames(api, "alerts", "api.fast_burn", "api.slow_burn"),
+					testCheckFakeLibratoAPINames(api, "spaces", "api SLO"),
+				),
+			},
+		},
+	})
+}
+
+const testLibratoSLOConfig_missingObjects = `
+resource "librato_slo" "foobar" {
+    name = "api"
+    good_metric = "api.requests.good"
+    total_metric = "api.requests.total"
+    target = 0.999
+    create_space = true
+}`
+
+func testAccCheckLibratoSLODestroy(s *terraform.State) error {
+	client := testAccProvider.Meta().(*Config).Client
+
+	for _, rs := range s.RootModule().Resources {
+		if rs.Type != "librato_slo" {
+			continue
+		}
+
+		for _, k := range []string{"fast_burn_alert_id", "slow_burn_alert_id"} {
+			id, err := strconv.ParseUint(rs.Primary.Attributes[k], 10, 0)
+			if err != nil {
+				return fmt.Errorf("ID not a number")
+			}
+
+			if _, _, err := client.Alerts.Get(uint(id)); err == nil {
+				return fmt.Errorf("Alert still exists")
+			}
+		}
+
+		if _, _, err := client.Metrics.Get(rs.Primary.Attributes["metric_names.0"]); err == nil {
+			return fmt.Errorf("Metric still exists")
+		}
+	}
+
+	return nil
+}
+
+func testAccCheckLibratoSLOAlertExists(n, key string, alert *librato.Alert) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		rs, ok := s.RootModule().Resources[n]
+
+		if !ok {
+			return fmt.Errorf("Not found: %s", n)
+		}
+
+		client := testAccProvider.Meta().(*Config).Client
+
+		id, err := strconv.ParseUint(rs.Primary.Attributes[key], 10, 0)
+		if err != nil {
+			return fmt.Errorf("ID not a number")
+		}
+
+		foundAlert, _, err := client.Alerts.Get(uint(id))
+
+		if err != nil {
+			return err
+		}
+
+		*alert = *foundAlert
+
+		return nil
+	}
+}
+
+func testAccCheckLibratoSLOThreshold(alert *librato.Alert, threshold float64) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		for _, c := range alert.Conditions {
+			if c.Threshold == nil || fmt.Sprintf("%.6f", *c.Threshold) != fmt.Sprintf("%.6f", threshold) {
+				return fmt.Errorf("Bad threshold: %v", c.Threshold)
+			}
+		}
+
+		return nil
+	}
+}
+
+func testAccCheckLibratoSLOConfig_basic(name, target string, createSpace bool) string {
+	return fmt.Sprintf(`
+resource "librato_slo" "foobar" {
+    name = "%s"
+    good_metric = "api.requests.good"
+    total_metric = "api.requests.total"
+    target = %s
+    create_space = %t
+}`, name, target, createSpace)
+}
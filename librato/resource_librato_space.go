@@ -28,24 +28,43 @@ func resourceLibratoSpace() *schema.Resource {
 				Type:     schema.TypeInt,
 				Computed: true,
 			},
+			"deletion_protection": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
 		},
 	}
 }
 
 func resourceLibratoSpaceCreate(d *schema.ResourceData, meta interface{}) error {
-	client := meta.(*librato.Client)
+	config := meta.(*Config)
+	client := config.Client
 
-	name := d.Get("name").(string)
+	name := config.affixName(d.Get("name").(string))
 
-	space, _, err := client.Spaces.Create(&librato.Space{Name: librato.String(name)})
+	var space *librato.Space
+	err := libratoCreateWithRecovery(fmt.Sprintf("space %s", name),
+		func() (err error) {
+			space, _, err = client.Spaces.Create(&librato.Space{Name: librato.String(name)})
+			return err
+		},
+		func(after uint) (uint, error) {
+			found, err := libratoFindSpace(client, name, after)
+			if found == nil {
+				return 0, err
+			}
+			space = found
+			return *found.ID, nil
+		})
 	if err != nil {
-		return fmt.Errorf("Error creating Librato space %s: %s", name, err)
+		return fmt.Errorf("Error creating Librato space %s: %s", name, libratoAttributeError(d, resourceLibratoSpace().Schema, err))
 	}
 
 	resource.Retry(1*time.Minute, func() *resource.RetryError {
 		_, _, err := client.Spaces.Get(*space.ID)
 		if err != nil {
-			if errResp, ok := err.(*librato.ErrorResponse); ok && errResp.Response.StatusCode == 404 {
+			if librato.IsNotFound(err) {
 				return resource.RetryableError(err)
 			}
 			return resource.NonRetryableError(err)
@@ -53,11 +72,12 @@ func resourceLibratoSpaceCreate(d *schema.ResourceData, meta interface{}) error
 		return nil
 	})
 
-	return resourceLibratoSpaceReadResult(d, space)
+	return resourceLibratoSpaceReadResult(d, config, space)
 }
 
 func resourceLibratoSpaceRead(d *schema.ResourceData, meta interface{}) error {
-	client := meta.(*librato.Client)
+	config := meta.(*Config)
+	client := config.Client
 
 	id, err := strconv.ParseUint(d.Id(), 10, 0)
 	if err != nil {
@@ -66,39 +86,40 @@ func resourceLibratoSpaceRead(d *schema.ResourceData, meta interface{}) error {
 
 	space, _, err := client.Spaces.Get(uint(id))
 	if err != nil {
-		if errResp, ok := err.(*librato.ErrorResponse); ok && errResp.Response.StatusCode == 404 {
+		if librato.IsNotFound(err) {
 			d.SetId("")
 			return nil
 		}
 		return fmt.Errorf("Error reading Librato Space %s: %s", d.Id(), err)
 	}
 
-	return resourceLibratoSpaceReadResult(d, space)
+	return resourceLibratoSpaceReadResult(d, config, space)
 }
 
-func resourceLibratoSpaceReadResult(d *schema.ResourceData, space *librato.Space) error {
+func resourceLibratoSpaceReadResult(d *schema.ResourceData, config *Config, space *librato.Space) error {
 	d.SetId(strconv.FormatUint(uint64(*space.ID), 10))
 	if err := d.Set("id", *space.ID); err != nil {
 		return err
 	}
-	if err := d.Set("name", *space.Name); err != nil {
+	if err := d.Set("name", config.stripName(*space.Name)); err != nil {
 		return err
 	}
 	return nil
 }
 
 func resourceLibratoSpaceUpdate(d *schema.ResourceData, meta interface{}) error {
-	client := meta.(*librato.Client)
+	config := meta.(*Config)
+	client := config.Client
 	id, err := strconv.ParseUint(d.Id(), 10, 0)
 	if err != nil {
 		return err
 	}
 
 	if d.HasChange("name") {
-		newName := d.Get("name").(string)
+		newName := config.affixName(d.Get("name").(string))
 		log.Printf("[INFO] Modifying name space attribute for %d: %#v", id, newName)
 		if _, err = client.Spaces.Update(uint(id), &librato.Space{Name: &newName}); err != nil {
-			return err
+			return libratoAttributeError(d, resourceLibratoSpace().Schema, err)
 		}
 	}
 
@@ -106,16 +127,23 @@ func resourceLibratoSpaceUpdate(d *schema.ResourceData, meta interface{}) error
 }
 
 func resourceLibratoSpaceDelete(d *schema.ResourceData, meta interface{}) error {
-	client := meta.(*librato.Client)
+	config := meta.(*Config)
+	client := config.Client
 	id, err := strconv.ParseUint(d.Id(), 10, 0)
 	if err != nil {
 		return err
 	}
 
+	if d.Get("deletion_protection").(bool) {
+		return fmt.Errorf("Librato space %d has deletion_protection enabled, set "+
+			"deletion_protection = false and apply before destroying it", id)
+	}
+
 	log.Printf("[INFO] Deleting Space: %d", id)
+	defer config.cache.evictSpace(uint(id))
 	_, err = client.Spaces.Delete(uint(id))
 	if err != nil {
-		if errResp, ok := err.(*librato.ErrorResponse); ok && errResp.Response.StatusCode == 404 {
+		if librato.IsNotFound(err) {
 			log.Printf("Space %s not found", d.Id())
 			d.SetId("")
 			return nil
@@ -126,7 +154,7 @@ func resourceLibratoSpaceDelete(d *schema.ResourceData, meta interface{}) error
 	resource.Retry(1*time.Minute, func() *resource.RetryError {
 		_, _, err := client.Spaces.Get(uint(id))
 		if err != nil {
-			if errResp, ok := err.(*librato.ErrorResponse); ok && errResp.Response.StatusCode == 404 {
+			if librato.IsNotFound(err) {
 				return nil
 			}
 			return resource.NonRetryableError(err)
@@ -137,3 +165,22 @@ func resourceLibratoSpaceDelete(d *schema.ResourceData, meta interface{}) error
 	d.SetId("")
 	return nil
 }
+
+// Lists the spaces whose names contain name, following every page.
+func libratoListSpaces(client *librato.Client, name string) ([]librato.Space, error) {
+	var spaces []librato.Space
+	opts := &librato.SpaceListOptions{Name: name}
+	for {
+		page, resp, err := client.Spaces.List(opts)
+		if err != nil {
+			return nil, err
+		}
+		spaces = append(spaces, page...)
+
+		if resp.NextPage == nil || len(page) == 0 {
+			return spaces, nil
+		}
+		next := opts.AdvancePage(resp.NextPage)
+		opts = &next
+	}
+}
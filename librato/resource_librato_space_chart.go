@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"fmt"
 	"log"
-	"math"
 	"reflect"
 	"strconv"
 	"time"
@@ -37,16 +36,8 @@ func resourceLibratoSpaceChart() *schema.Resource {
 				Required: true,
 				ForceNew: true,
 			},
-			"min": {
-				Type:     schema.TypeFloat,
-				Default:  math.NaN(),
-				Optional: true,
-			},
-			"max": {
-				Type:     schema.TypeFloat,
-				Default:  math.NaN(),
-				Optional: true,
-			},
+			"min": libratoNullableFloatSchema(),
+			"max": libratoNullableFloatSchema(),
 			"label": {
 				Type:     schema.TypeString,
 				Optional: true,
@@ -73,6 +64,7 @@ func resourceLibratoSpaceChart() *schema.Resource {
 						"group_function": {
 							Type:          schema.TypeString,
 							Optional:      true,
+							Computed:      true,
 							ConflictsWith: []string{"stream.composite"},
 						},
 						"composite": {
@@ -83,6 +75,7 @@ func resourceLibratoSpaceChart() *schema.Resource {
 						"summary_function": {
 							Type:     schema.TypeString,
 							Optional: true,
+							Computed: true,
 						},
 						"name": {
 							Type:     schema.TypeString,
@@ -100,16 +93,8 @@ func resourceLibratoSpaceChart() *schema.Resource {
 							Type:     schema.TypeString,
 							Optional: true,
 						},
-						"min": {
-							Type:     schema.TypeFloat,
-							Default:  math.NaN(),
-							Optional: true,
-						},
-						"max": {
-							Type:     schema.TypeFloat,
-							Default:  math.NaN(),
-							Optional: true,
-						},
+						"min": libratoNullableFloatSchema(),
+						"max": libratoNullableFloatSchema(),
 						"transform_function": {
 							Type:     schema.TypeString,
 							Optional: true,
@@ -118,6 +103,7 @@ func resourceLibratoSpaceChart() *schema.Resource {
 							Type:     schema.TypeInt,
 							Optional: true,
 						},
+						"tag": libratoTagSchema(true),
 					},
 				},
 				Set: resourceLibratoSpaceChartHash,
@@ -132,36 +118,35 @@ func resourceLibratoSpaceChartHash(v interface{}) int {
 	buf.WriteString(fmt.Sprintf("%s-", m["metric"].(string)))
 	buf.WriteString(fmt.Sprintf("%s-", m["source"].(string)))
 	buf.WriteString(fmt.Sprintf("%s-", m["composite"].(string)))
+	libratoTagsHash(&buf, m)
 
 	return hashcode.String(buf.String())
 }
 
 func resourceLibratoSpaceChartCreate(d *schema.ResourceData, meta interface{}) error {
-	client := meta.(*librato.Client)
+	config := meta.(*Config)
+	client := config.Client
+
+	if err := config.checkPolicy("librato_space_chart", d); err != nil {
+		return err
+	}
+	if err := config.checkBackend("librato_space_chart", d); err != nil {
+		return err
+	}
 
 	spaceID := uint(d.Get("space_id").(int))
+	libratoSpaceMutexKV.Lock(libratoSpaceLockKey(spaceID))
+	defer libratoSpaceMutexKV.Unlock(libratoSpaceLockKey(spaceID))
 
 	spaceChart := new(librato.SpaceChart)
 	if v, ok := d.GetOk("name"); ok {
-		spaceChart.Name = librato.String(v.(string))
+		spaceChart.Name = librato.String(config.affixName(v.(string)))
 	}
 	if v, ok := d.GetOk("type"); ok {
 		spaceChart.Type = librato.String(v.(string))
 	}
-	if v, ok := d.GetOk("min"); ok {
-		if math.IsNaN(v.(float64)) {
-			spaceChart.Min = nil
-		} else {
-			spaceChart.Min = librato.Float(v.(float64))
-		}
-	}
-	if v, ok := d.GetOk("max"); ok {
-		if math.IsNaN(v.(float64)) {
-			spaceChart.Max = nil
-		} else {
-			spaceChart.Max = librato.Float(v.(float64))
-		}
-	}
+	spaceChart.Min = libratoNullableFloatExpand(d.Get("min"))
+	spaceChart.Max = libratoNullableFloatExpand(d.Get("max"))
 	if v, ok := d.GetOk("label"); ok {
 		spaceChart.Label = librato.String(v.(string))
 	}
@@ -169,70 +154,48 @@ func resourceLibratoSpaceChartCreate(d *schema.ResourceData, meta interface{}) e
 		spaceChart.RelatedSpace = librato.Uint(uint(v.(int)))
 	}
 	if v, ok := d.GetOk("stream"); ok {
-		vs := v.(*schema.Set)
-		streams := make([]librato.SpaceChartStream, vs.Len())
-		for i, streamDataM := range vs.List() {
-			streamData := streamDataM.(map[string]interface{})
-			var stream librato.SpaceChartStream
-			if v, ok := streamData["metric"].(string); ok && v != "" {
-				stream.Metric = librato.String(v)
-			}
-			if v, ok := streamData["source"].(string); ok && v != "" {
-				stream.Source = librato.String(v)
-			}
-			if v, ok := streamData["composite"].(string); ok && v != "" {
-				stream.Composite = librato.String(v)
-			}
-			if v, ok := streamData["group_function"].(string); ok && v != "" {
-				stream.GroupFunction = librato.String(v)
-			}
-			if v, ok := streamData["summary_function"].(string); ok && v != "" {
-				stream.SummaryFunction = librato.String(v)
-			}
-			if v, ok := streamData["transform_function"].(string); ok && v != "" {
-				stream.TransformFunction = librato.String(v)
-			}
-			if v, ok := streamData["color"].(string); ok && v != "" {
-				stream.Color = librato.String(v)
-			}
-			if v, ok := streamData["units_short"].(string); ok && v != "" {
-				stream.UnitsShort = librato.String(v)
-			}
-			if v, ok := streamData["units_longs"].(string); ok && v != "" {
-				stream.UnitsLong = librato.String(v)
-			}
-			if v, ok := streamData["min"].(float64); ok && !math.IsNaN(v) {
-				stream.Min = librato.Float(v)
-			}
-			if v, ok := streamData["max"].(float64); ok && !math.IsNaN(v) {
-				stream.Max = librato.Float(v)
-			}
-			streams[i] = stream
-		}
-		spaceChart.Streams = streams
+		spaceChart.Streams = resourceLibratoSpaceChartStreamsExpand(config, v.(*schema.Set))
 	}
 
-	spaceChartResult, _, err := client.Spaces.CreateChart(spaceID, spaceChart)
+	var spaceChartResult *librato.SpaceChart
+	err := libratoCreateWithRecovery(fmt.Sprintf("space chart %s", stringValue(spaceChart.Name)),
+		func() (err error) {
+			spaceChartResult, _, err = client.Spaces.CreateChart(spaceID, spaceChart)
+			return err
+		},
+		func(after uint) (uint, error) {
+			// Unnamed charts can't be told apart
+			if spaceChart.Name == nil {
+				return 0, nil
+			}
+			found, err := libratoFindSpaceChart(client, spaceID, *spaceChart.Name, stringValue(spaceChart.Type), after)
+			if found == nil {
+				return 0, err
+			}
+			spaceChartResult = found
+			return *found.ID, nil
+		})
 	if err != nil {
-		return fmt.Errorf("Error creating Librato space chart %s: %s", *spaceChart.Name, err)
+		return fmt.Errorf("Error creating Librato space chart %s: %s", *spaceChart.Name, libratoAttributeError(d, resourceLibratoSpaceChart().Schema, err))
 	}
 
 	resource.Retry(1*time.Minute, func() *resource.RetryError {
 		_, _, err := client.Spaces.GetChart(spaceID, *spaceChartResult.ID)
 		if err != nil {
-			if errResp, ok := err.(*librato.ErrorResponse); ok && errResp.Response.StatusCode == 404 {
+			if librato.IsNotFound(err) {
 				return resource.RetryableError(err)
 			}
 			return resource.NonRetryableError(err)
 		}
 		return nil
 	})
+	config.annotateChange(d, "librato_space_chart", "created", stringValue(spaceChartResult.Name), nil)
 
-	return resourceLibratoSpaceChartReadResult(d, spaceChartResult)
+	return resourceLibratoSpaceChartReadResult(d, config, spaceChartResult)
 }
 
 func resourceLibratoSpaceChartRead(d *schema.ResourceData, meta interface{}) error {
-	client := meta.(*librato.Client)
+	config := meta.(*Config)
 
 	spaceID := uint(d.Get("space_id").(int))
 
@@ -241,22 +204,22 @@ func resourceLibratoSpaceChartRead(d *schema.ResourceData, meta interface{}) err
 		return err
 	}
 
-	chart, _, err := client.Spaces.GetChart(spaceID, uint(id))
+	chart, err := config.cache.getChart(spaceID, uint(id))
 	if err != nil {
-		if errResp, ok := err.(*librato.ErrorResponse); ok && errResp.Response.StatusCode == 404 {
+		if librato.IsNotFound(err) {
 			d.SetId("")
 			return nil
 		}
 		return fmt.Errorf("Error reading Librato Space chart %s: %s", d.Id(), err)
 	}
 
-	return resourceLibratoSpaceChartReadResult(d, chart)
+	return resourceLibratoSpaceChartReadResult(d, config, chart)
 }
 
-func resourceLibratoSpaceChartReadResult(d *schema.ResourceData, chart *librato.SpaceChart) error {
+func resourceLibratoSpaceChartReadResult(d *schema.ResourceData, config *Config, chart *librato.SpaceChart) error {
 	d.SetId(strconv.FormatUint(uint64(*chart.ID), 10))
 	if chart.Name != nil {
-		if err := d.Set("name", *chart.Name); err != nil {
+		if err := d.Set("name", config.stripName(*chart.Name)); err != nil {
 			return err
 		}
 	}
@@ -265,15 +228,11 @@ func resourceLibratoSpaceChartReadResult(d *schema.ResourceData, chart *librato.
 			return err
 		}
 	}
-	if chart.Min != nil {
-		if err := d.Set("min", *chart.Min); err != nil {
-			return err
-		}
+	if err := d.Set("min", libratoNullableFloatFlatten(chart.Min)); err != nil {
+		return err
 	}
-	if chart.Max != nil {
-		if err := d.Set("max", *chart.Max); err != nil {
-			return err
-		}
+	if err := d.Set("max", libratoNullableFloatFlatten(chart.Max)); err != nil {
+		return err
 	}
 	if chart.Label != nil {
 		if err := d.Set("label", *chart.Label); err != nil {
@@ -286,7 +245,7 @@ func resourceLibratoSpaceChartReadResult(d *schema.ResourceData, chart *librato.
 		}
 	}
 
-	streams := resourceLibratoSpaceChartStreamsGather(d, chart.Streams)
+	streams := resourceLibratoSpaceChartStreamsGather(d, config, chart.Streams)
 	if err := d.Set("stream", streams); err != nil {
 		return err
 	}
@@ -294,18 +253,65 @@ func resourceLibratoSpaceChartReadResult(d *schema.ResourceData, chart *librato.
 	return nil
 }
 
-func resourceLibratoSpaceChartStreamsGather(d *schema.ResourceData, streams []librato.SpaceChartStream) []map[string]interface{} {
+func resourceLibratoSpaceChartStreamsExpand(config *Config, vs *schema.Set) []librato.SpaceChartStream {
+	streams := make([]librato.SpaceChartStream, vs.Len())
+	for i, streamDataM := range vs.List() {
+		streamData := streamDataM.(map[string]interface{})
+		var stream librato.SpaceChartStream
+		if v, ok := streamData["metric"].(string); ok && v != "" {
+			stream.Metric = librato.String(config.affixMetricName(v))
+		}
+		if v, ok := streamData["source"].(string); ok && v != "" {
+			stream.Source = librato.String(v)
+		}
+		if v, ok := streamData["composite"].(string); ok && v != "" {
+			stream.Composite = librato.String(config.affixComposite(v))
+		}
+		if v, ok := streamData["group_function"].(string); ok && v != "" {
+			stream.GroupFunction = librato.String(v)
+		}
+		if v, ok := streamData["summary_function"].(string); ok && v != "" {
+			stream.SummaryFunction = librato.String(v)
+		}
+		if v, ok := streamData["transform_function"].(string); ok && v != "" {
+			stream.TransformFunction = librato.String(v)
+		}
+		if v, ok := streamData["name"].(string); ok && v != "" {
+			stream.Name = librato.String(v)
+		}
+		if v, ok := streamData["color"].(string); ok && v != "" {
+			stream.Color = librato.String(v)
+		}
+		if v, ok := streamData["units_short"].(string); ok && v != "" {
+			stream.UnitsShort = librato.String(v)
+		}
+		if v, ok := streamData["units_long"].(string); ok && v != "" {
+			stream.UnitsLong = librato.String(v)
+		}
+		if v, ok := streamData["period"].(int); ok && v > 0 {
+			period := int64(v)
+			stream.Period = &period
+		}
+		stream.Min = libratoNullableFloatExpand(streamData["min"])
+		stream.Max = libratoNullableFloatExpand(streamData["max"])
+		stream.Tags = resourceLibratoSpaceChartStreamTagsExpand(streamData)
+		streams[i] = stream
+	}
+	return streams
+}
+
+func resourceLibratoSpaceChartStreamsGather(d *schema.ResourceData, config *Config, streams []librato.SpaceChartStream) []map[string]interface{} {
 	retStreams := make([]map[string]interface{}, 0, len(streams))
 	for _, s := range streams {
 		stream := make(map[string]interface{})
 		if s.Metric != nil {
-			stream["metric"] = *s.Metric
+			stream["metric"] = config.stripMetricName(*s.Metric)
 		}
 		if s.Source != nil {
 			stream["source"] = *s.Source
 		}
 		if s.Composite != nil {
-			stream["composite"] = *s.Composite
+			stream["composite"] = config.stripComposite(*s.Composite)
 		}
 		if s.GroupFunction != nil {
 			stream["group_function"] = *s.GroupFunction
@@ -325,20 +331,80 @@ func resourceLibratoSpaceChartStreamsGather(d *schema.ResourceData, streams []li
 		if s.UnitsLong != nil {
 			stream["units_long"] = *s.UnitsLong
 		}
+		if s.Name != nil {
+			stream["name"] = *s.Name
+		}
+		if s.Period != nil {
+			stream["period"] = int(*s.Period)
+		}
+		stream["min"] = libratoNullableFloatFlatten(s.Min)
+		stream["max"] = libratoNullableFloatFlatten(s.Max)
+		if len(s.Tags) > 0 {
+			stream["tag"] = resourceLibratoSpaceChartStreamTagsGather(s.Tags)
+		}
 		retStreams = append(retStreams, stream)
 	}
 
 	return retStreams
 }
 
+func resourceLibratoSpaceChartStreamTagsExpand(streamData map[string]interface{}) []librato.SpaceChartStreamTag {
+	var tags []librato.SpaceChartStreamTag
+	for _, t := range streamData["tag"].([]interface{}) {
+		tagData := t.(map[string]interface{})
+		tag := librato.SpaceChartStreamTag{
+			Name: librato.String(tagData["name"].(string)),
+		}
+		if v, ok := tagData["grouped"].(bool); ok && v {
+			tag.Grouped = librato.Bool(v)
+		}
+		if v, ok := tagData["dynamic"].(bool); ok && v {
+			tag.Dynamic = librato.Bool(v)
+		}
+		for _, tv := range tagData["values"].([]interface{}) {
+			tag.Values = append(tag.Values, librato.String(tv.(string)))
+		}
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+func resourceLibratoSpaceChartStreamTagsGather(tags []librato.SpaceChartStreamTag) []interface{} {
+	retTags := make([]interface{}, 0, len(tags))
+	for _, t := range tags {
+		tag := map[string]interface{}{
+			"name":   stringValue(t.Name),
+			"values": libratoStringsFlatten(t.Values),
+		}
+		if t.Grouped != nil {
+			tag["grouped"] = *t.Grouped
+		}
+		if t.Dynamic != nil {
+			tag["dynamic"] = *t.Dynamic
+		}
+		retTags = append(retTags, tag)
+	}
+	return retTags
+}
+
 func resourceLibratoSpaceChartUpdate(d *schema.ResourceData, meta interface{}) error {
-	client := meta.(*librato.Client)
+	config := meta.(*Config)
+	client := config.Client
+
+	if err := config.checkPolicy("librato_space_chart", d); err != nil {
+		return err
+	}
+	if err := config.checkBackend("librato_space_chart", d); err != nil {
+		return err
+	}
 
 	spaceID := uint(d.Get("space_id").(int))
 	chartID, err := strconv.ParseUint(d.Id(), 10, 0)
 	if err != nil {
 		return err
 	}
+	libratoSpaceMutexKV.Lock(libratoSpaceLockKey(spaceID))
+	defer libratoSpaceMutexKV.Unlock(libratoSpaceLockKey(spaceID))
 
 	// Just to have whole object for comparison before/after update
 	fullChart, _, err := client.Spaces.GetChart(spaceID, uint(chartID))
@@ -348,23 +414,15 @@ func resourceLibratoSpaceChartUpdate(d *schema.ResourceData, meta interface{}) e
 
 	spaceChart := new(librato.SpaceChart)
 	if d.HasChange("name") {
-		spaceChart.Name = librato.String(d.Get("name").(string))
+		spaceChart.Name = librato.String(config.affixName(d.Get("name").(string)))
 		fullChart.Name = spaceChart.Name
 	}
 	if d.HasChange("min") {
-		if math.IsNaN(d.Get("min").(float64)) {
-			spaceChart.Min = nil
-		} else {
-			spaceChart.Min = librato.Float(d.Get("min").(float64))
-		}
+		spaceChart.Min = libratoNullableFloatExpand(d.Get("min"))
 		fullChart.Min = spaceChart.Min
 	}
 	if d.HasChange("max") {
-		if math.IsNaN(d.Get("max").(float64)) {
-			spaceChart.Max = nil
-		} else {
-			spaceChart.Max = librato.Float(d.Get("max").(float64))
-		}
+		spaceChart.Max = libratoNullableFloatExpand(d.Get("max"))
 		fullChart.Max = spaceChart.Max
 	}
 	if d.HasChange("label") {
@@ -372,57 +430,18 @@ func resourceLibratoSpaceChartUpdate(d *schema.ResourceData, meta interface{}) e
 		fullChart.Label = spaceChart.Label
 	}
 	if d.HasChange("related_space") {
-		spaceChart.RelatedSpace = librato.Uint(d.Get("related_space").(uint))
+		spaceChart.RelatedSpace = librato.Uint(uint(d.Get("related_space").(int)))
 		fullChart.RelatedSpace = spaceChart.RelatedSpace
 	}
 	if d.HasChange("stream") {
-		vs := d.Get("stream").(*schema.Set)
-		streams := make([]librato.SpaceChartStream, vs.Len())
-		for i, streamDataM := range vs.List() {
-			streamData := streamDataM.(map[string]interface{})
-			var stream librato.SpaceChartStream
-			if v, ok := streamData["metric"].(string); ok && v != "" {
-				stream.Metric = librato.String(v)
-			}
-			if v, ok := streamData["source"].(string); ok && v != "" {
-				stream.Source = librato.String(v)
-			}
-			if v, ok := streamData["composite"].(string); ok && v != "" {
-				stream.Composite = librato.String(v)
-			}
-			if v, ok := streamData["group_function"].(string); ok && v != "" {
-				stream.GroupFunction = librato.String(v)
-			}
-			if v, ok := streamData["summary_function"].(string); ok && v != "" {
-				stream.SummaryFunction = librato.String(v)
-			}
-			if v, ok := streamData["transform_function"].(string); ok && v != "" {
-				stream.TransformFunction = librato.String(v)
-			}
-			if v, ok := streamData["color"].(string); ok && v != "" {
-				stream.Color = librato.String(v)
-			}
-			if v, ok := streamData["units_short"].(string); ok && v != "" {
-				stream.UnitsShort = librato.String(v)
-			}
-			if v, ok := streamData["units_longs"].(string); ok && v != "" {
-				stream.UnitsLong = librato.String(v)
-			}
-			if v, ok := streamData["min"].(float64); ok && !math.IsNaN(v) {
-				stream.Min = librato.Float(v)
-			}
-			if v, ok := streamData["max"].(float64); ok && !math.IsNaN(v) {
-				stream.Max = librato.Float(v)
-			}
-			streams[i] = stream
-		}
-		spaceChart.Streams = streams
-		fullChart.Streams = streams
+		spaceChart.Streams = resourceLibratoSpaceChartStreamsExpand(config, d.Get("stream").(*schema.Set))
+		fullChart.Streams = spaceChart.Streams
 	}
 
 	_, err = client.Spaces.UpdateChart(spaceID, uint(chartID), spaceChart)
+	config.cache.evictChart(spaceID, uint(chartID))
 	if err != nil {
-		return fmt.Errorf("Error updating Librato space chart %s: %s", *spaceChart.Name, err)
+		return fmt.Errorf("Error updating Librato space chart %s: %s", config.affixName(d.Get("name").(string)), libratoAttributeError(d, resourceLibratoSpaceChart().Schema, err))
 	}
 
 	// Wait for propagation since Librato updates are eventually consistent
@@ -448,12 +467,14 @@ func resourceLibratoSpaceChartUpdate(d *schema.ResourceData, meta interface{}) e
 	if err != nil {
 		return fmt.Errorf("Failed updating Librato Space Chart %d: %s", chartID, err)
 	}
+	config.annotateChange(d, "librato_space_chart", "updated", config.affixName(d.Get("name").(string)), resourceLibratoSpaceChart().Schema)
 
 	return resourceLibratoSpaceChartRead(d, meta)
 }
 
 func resourceLibratoSpaceChartDelete(d *schema.ResourceData, meta interface{}) error {
-	client := meta.(*librato.Client)
+	config := meta.(*Config)
+	client := config.Client
 
 	spaceID := uint(d.Get("space_id").(int))
 
@@ -461,6 +482,9 @@ func resourceLibratoSpaceChartDelete(d *schema.ResourceData, meta interface{}) e
 	if err != nil {
 		return err
 	}
+	libratoSpaceMutexKV.Lock(libratoSpaceLockKey(spaceID))
+	defer libratoSpaceMutexKV.Unlock(libratoSpaceLockKey(spaceID))
+	defer config.cache.evictChart(spaceID, uint(id))
 
 	log.Printf("[INFO] Deleting Chart: %d/%d", spaceID, uint(id))
 	_, err = client.Spaces.DeleteChart(spaceID, uint(id))
@@ -471,13 +495,14 @@ func resourceLibratoSpaceChartDelete(d *schema.ResourceData, meta interface{}) e
 	resource.Retry(1*time.Minute, func() *resource.RetryError {
 		_, _, err := client.Spaces.GetChart(spaceID, uint(id))
 		if err != nil {
-			if errResp, ok := err.(*librato.ErrorResponse); ok && errResp.Response.StatusCode == 404 {
+			if librato.IsNotFound(err) {
 				return nil
 			}
 			return resource.NonRetryableError(err)
 		}
 		return resource.RetryableError(fmt.Errorf("space chart still exists"))
 	})
+	config.annotateChange(d, "librato_space_chart", "deleted", config.affixName(d.Get("name").(string)), nil)
 
 	d.SetId("")
 	return nil
@@ -2,6 +2,7 @@ package librato
 
 import (
 	"fmt"
+	"regexp"
 	"strconv"
 	"testing"
 
@@ -83,7 +84,7 @@ func TestAccLibratoSpaceChart_Updated(t *testing.T) {
 }
 
 func testAccCheckLibratoSpaceChartDestroy(s *terraform.State) error {
-	client := testAccProvider.Meta().(*librato.Client)
+	client := testAccProvider.Meta().(*Config).Client
 
 	for _, rs := range s.RootModule().Resources {
 		if rs.Type != "librato_space_chart" {
@@ -133,7 +134,7 @@ func testAccCheckLibratoSpaceChartExists(n string, spaceChart *librato.SpaceChar
 			return fmt.Errorf("No Space Chart ID is set")
 		}
 
-		client := testAccProvider.Meta().(*librato.Client)
+		client := testAccProvider.Meta().(*Config).Client
 
 		id, err := strconv.ParseUint(rs.Primary.ID, 10, 0)
 		if err != nil {
@@ -228,3 +229,49 @@ resource "librato_space_chart" "foobar" {
         period = 60
     }
 }`
+
+func TestLibratoSpaceChart_updateParamError(t *testing.T) {
+	api, server := newFakeLibratoAPI()
+	defer server.Close()
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers:    testFakeLibratoProviders(server),
+		CheckDestroy: testCheckFakeLibratoAPIEmpty(api),
+		Steps: []resource.TestStep{
+			{
+				Config: testFakeLibratoProviderConfig + testLibratoSpaceChartConfig_paramError(""),
+			},
+			{
+				// The update doesn't rename the chart
+				PreConfig: func() {
+					api.reject("PUT", "charts", map[string]interface{}{
+						"streams": map[string]interface{}{
+							"0": map[string]interface{}{"metric": []interface{}{"is invalid"}},
+						},
+					})
+				},
+				Config:      testFakeLibratoProviderConfig + testLibratoSpaceChartConfig_paramError(`related_space = "${librato_space.foobar.id}"`),
+				ExpectError: regexp.MustCompile(`Error updating Librato space chart Foo Bar: .*\n\n  stream\.\d+\.metric = "foo\.bar": is invalid`),
+			},
+		},
+	})
+}
+
+func testLibratoSpaceChartConfig_paramError(relatedSpace string) string {
+	return fmt.Sprintf(`
+resource "librato_space" "foobar" {
+    name = "Foo Bar"
+}
+
+resource "librato_space_chart" "foobar" {
+    space_id = "${librato_space.foobar.id}"
+    name = "Foo Bar"
+    type = "line"
+    %s
+
+    stream {
+      metric = "foo.bar"
+      source = "*"
+    }
+}`, relatedSpace)
+}
@@ -34,7 +34,7 @@ func TestAccLibratoSpace_Basic(t *testing.T) {
 }
 
 func testAccCheckLibratoSpaceDestroy(s *terraform.State) error {
-	client := testAccProvider.Meta().(*librato.Client)
+	client := testAccProvider.Meta().(*Config).Client
 
 	for _, rs := range s.RootModule().Resources {
 		if rs.Type != "librato_space" {
@@ -79,7 +79,7 @@ func testAccCheckLibratoSpaceExists(n string, space *librato.Space) resource.Tes
 			return fmt.Errorf("No Space ID is set")
 		}
 
-		client := testAccProvider.Meta().(*librato.Client)
+		client := testAccProvider.Meta().(*Config).Client
 
 		id, err := strconv.ParseUint(rs.Primary.ID, 10, 0)
 		if err != nil {